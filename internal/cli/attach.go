@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juliuswalton/scrbl/internal/config"
+	"github.com/juliuswalton/scrbl/internal/dayfiles"
+	"github.com/juliuswalton/scrbl/notes"
+	syncclient "github.com/juliuswalton/scrbl/sync"
+)
+
+// imageExts are linked as images rather than plain links.
+var imageExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".svg": true,
+}
+
+// runAttach copies files into the assets folder, links them from a day's
+// note and, when a server is configured, uploads them before pushing the
+// note.
+func runAttach(args []string) error {
+	fs := flag.NewFlagSet("attach", flag.ContinueOnError)
+	date := fs.String("date", "", "day to attach to (YYYY-MM-DD), default today")
+	noSync := fs.Bool("no-sync", false, "only attach locally; upload on the next `scrbl sync`")
+
+	// Allow flags after the files, as in: scrbl attach shot.png --date 2026-02-17
+	var files []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("missing file to attach")
+	}
+
+	day, err := dayfiles.ParseDateOrToday(*date)
+	if err != nil {
+		return err
+	}
+	key := day.Format(dayfiles.DateLayout)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	links := make([]string, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read attachment: %w", err)
+		}
+		base := filepath.Base(file)
+		name := dayfiles.AssetName(syncclient.AttachmentHash(data), base)
+		if err := dayfiles.WriteAsset(cfg.NotesDir, name, data); err != nil {
+			return err
+		}
+		links = append(links, assetLink(base, name))
+	}
+
+	store := notes.NewStore(cfg.NotesDir)
+	if err := store.AppendEntry(day, strings.Join(links, "\n")); err != nil {
+		return err
+	}
+	for _, link := range links {
+		fmt.Printf("attached %s to %s\n", link, key)
+	}
+
+	if *noSync {
+		return nil
+	}
+	client, err := newSyncClient(cfg)
+	if err != nil || client == nil {
+		return err
+	}
+
+	content, err := store.ReadDay(day)
+	if err != nil {
+		return err
+	}
+	if err := pushAssets(cfg, client, content); err != nil {
+		fmt.Fprintf(os.Stderr, "upload failed: %v\n", err)
+		fmt.Fprintln(os.Stderr, "attached locally only; run `scrbl sync` later to upload it")
+		return nil
+	}
+	if err := pushNote(client, day, content, false); err != nil {
+		if syncclient.IsConflict(err) {
+			return fmt.Errorf("%w\n  the attachment was uploaded; run `scrbl sync pull --date %s` to review the server copy", err, key)
+		}
+		fmt.Fprintf(os.Stderr, "push failed: %v\n", err)
+		fmt.Fprintln(os.Stderr, "attached locally only; run `scrbl sync` later to push it")
+		return nil
+	}
+
+	fmt.Printf("pushed %s\n", key)
+	return nil
+}
+
+// assetLink returns the markdown linking to an asset, as an image when it
+// looks like one.
+func assetLink(label, name string) string {
+	label = strings.NewReplacer("[", `\[`, "]", `\]`).Replace(label)
+	target := dayfiles.AssetsDir + "/" + name
+	if imageExts[filepath.Ext(name)] {
+		return fmt.Sprintf("![%s](%s)", label, target)
+	}
+	return fmt.Sprintf("[%s](%s)", label, target)
+}
+
+// pushAssets uploads the local assets a note links to that the server does
+// not have yet, so a note never reaches the server ahead of its attachments.
+// Links to assets missing locally are skipped.
+func pushAssets(cfg config.Config, client *syncclient.Client, content string) error {
+	for _, name := range dayfiles.AssetRefs(content) {
+		data, err := os.ReadFile(dayfiles.AssetPath(cfg.NotesDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read asset: %w", err)
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		hash, err := client.PushAttachment(context.Background(), data, contentType)
+		if err != nil {
+			return fmt.Errorf("upload %s: %w", name, err)
+		}
+		if hash != dayfiles.AssetHash(name) {
+			return fmt.Errorf("%s/%s was modified after it was attached", dayfiles.AssetsDir, name)
+		}
+	}
+	return nil
+}
+
+// fetchAssets downloads the assets a note links to that are missing locally.
+// It returns how many were fetched; failures are printed and counted.
+func fetchAssets(cfg config.Config, client *syncclient.Client, content string) (fetched, failed int) {
+	for _, name := range dayfiles.AssetRefs(content) {
+		if _, err := os.Stat(dayfiles.AssetPath(cfg.NotesDir, name)); err == nil {
+			continue
+		}
+
+		data, err := client.PullAttachment(context.Background(), dayfiles.AssetHash(name))
+		if errors.Is(err, syncclient.ErrAttachmentNotFound) {
+			fmt.Fprintf(os.Stderr, "skip %s/%s: not on the server\n", dayfiles.AssetsDir, name)
+			continue
+		}
+		if err == nil {
+			err = dayfiles.WriteAsset(cfg.NotesDir, name, data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fail %s/%s: %v\n", dayfiles.AssetsDir, name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("fetched %s/%s\n", dayfiles.AssetsDir, name)
+		fetched++
+	}
+	return fetched, failed
+}
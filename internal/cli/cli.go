@@ -25,6 +25,18 @@ func Run(args []string) error {
 		return runSummary(args[1:])
 	case "sync":
 		return runSync(args[1:])
+	case "search":
+		return runSearch(args[1:])
+	case "history":
+		return runHistory(args[1:])
+	case "restore":
+		return runRestore(args[1:])
+	case "rm":
+		return runRm(args[1:])
+	case "attach":
+		return runAttach(args[1:])
+	case "share":
+		return runShare(args[1:])
 	default:
 		printUsage()
 		return fmt.Errorf("unknown command %q", args[0])
@@ -40,15 +52,29 @@ func printUsage() {
 	fmt.Println("  tui                 Open notes stream + embedded neovim composer")
 	fmt.Println("  migrate             Migrate local note format")
 	fmt.Println("  summary             Copy latest ## Summary as Slack markdown")
+	fmt.Println("  sync                Push local changes and pull remote changes")
 	fmt.Println("  sync push           Push local note(s) to the server")
 	fmt.Println("  sync pull           Pull remote note(s) into local notes")
+	fmt.Println("  search <query>      Search local notes (or the server with --remote)")
+	fmt.Println("  history             List server revisions of a day")
+	fmt.Println("  restore             Restore a day to an older server revision")
+	fmt.Println("  rm --date <day>     Delete a day locally and on the server")
+	fmt.Println("  attach <file>...    Copy files into assets/ and link them from today's note")
+	fmt.Println("  share               Print a public link to a day that needs no API key")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  scrbl init --server https://scrbl.example.com --api-key <key>")
 	fmt.Println("  scrbl tui")
 	fmt.Println("  scrbl summary")
 	fmt.Println("  scrbl migrate --sync")
+	fmt.Println("  scrbl sync")
 	fmt.Println("  scrbl sync push --date 2026-02-17")
 	fmt.Println("  scrbl sync push --all")
 	fmt.Println("  scrbl sync pull --all")
+	fmt.Println("  scrbl search deploy -C 2 --from 2026-01-01")
+	fmt.Println("  scrbl history --date 2026-02-17")
+	fmt.Println("  scrbl restore --date 2026-02-17 --revision 3")
+	fmt.Println("  scrbl rm --date 2026-02-17")
+	fmt.Println("  scrbl attach screenshot.png --date 2026-02-17")
+	fmt.Println("  scrbl share --date 2026-02-17 --expires 7d")
 }
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/juliuswalton/scrbl/internal/dayfiles"
+)
+
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	date := fs.String("date", "", "date to inspect (YYYY-MM-DD), default today")
+	revision := fs.Int64("revision", 0, "print the content of this revision instead of listing")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("history does not take positional arguments")
+	}
+
+	_, client, err := loadSyncClient()
+	if err != nil {
+		return err
+	}
+
+	day, err := dayfiles.ParseDateOrToday(*date)
+	if err != nil {
+		return err
+	}
+
+	if *revision > 0 {
+		rev, err := client.GetRevision(day, *revision)
+		if err != nil {
+			return err
+		}
+		fmt.Print(rev.Content)
+		if !strings.HasSuffix(rev.Content, "\n") {
+			fmt.Println()
+		}
+		return nil
+	}
+
+	revs, err := client.ListRevisions(day)
+	if err != nil {
+		return err
+	}
+	if len(revs) == 0 {
+		fmt.Printf("no remote history for %s\n", day.Format(dayfiles.DateLayout))
+		return nil
+	}
+
+	fmt.Printf("history for %s (newest first):\n", day.Format(dayfiles.DateLayout))
+	for _, rev := range revs {
+		if rev.Deleted {
+			fmt.Printf("  %4d  %s  deleted\n", rev.Revision, rev.CreatedAt)
+			continue
+		}
+		fmt.Printf("  %4d  %s  %d bytes\n", rev.Revision, rev.CreatedAt, rev.Size)
+	}
+
+	return nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	date := fs.String("date", "", "date to restore (YYYY-MM-DD), default today")
+	revision := fs.Int64("revision", 0, "revision to restore (see: scrbl history)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("restore does not take positional arguments")
+	}
+	if *revision < 1 {
+		return fmt.Errorf("--revision is required")
+	}
+
+	cfg, client, err := loadSyncClient()
+	if err != nil {
+		return err
+	}
+
+	day, err := dayfiles.ParseDateOrToday(*date)
+	if err != nil {
+		return err
+	}
+
+	note, err := client.RestoreRevision(day, *revision)
+	if err != nil {
+		return err
+	}
+
+	if note.Deleted {
+		err = dayfiles.Remove(cfg.NotesDir, day)
+	} else {
+		err = dayfiles.Write(cfg.NotesDir, day, note.Content)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored %s to revision %d (now revision %d)\n", day.Format(dayfiles.DateLayout), *revision, note.Revision)
+	return nil
+}
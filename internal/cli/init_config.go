@@ -20,6 +20,8 @@ func runInit(args []string) error {
 	notesDir := fs.String("notes-dir", cfg.NotesDir, "directory where local day markdown files live")
 	serverURL := fs.String("server", cfg.ServerURL, "sync server URL")
 	apiKey := fs.String("api-key", cfg.APIKey, "sync API key")
+	passphrase := fs.String("encryption-passphrase", cfg.EncryptionPassphrase, "encrypt synced notes with a key derived from this passphrase")
+	keyFile := fs.String("encryption-key-file", cfg.EncryptionKeyFile, "encrypt synced notes with a key derived from this file")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -31,6 +33,11 @@ func runInit(args []string) error {
 	cfg.NotesDir = strings.TrimSpace(*notesDir)
 	cfg.ServerURL = strings.TrimSpace(*serverURL)
 	cfg.APIKey = strings.TrimSpace(*apiKey)
+	cfg.EncryptionPassphrase = *passphrase
+	cfg.EncryptionKeyFile = strings.TrimSpace(*keyFile)
+	if cfg.EncryptionPassphrase != "" && cfg.EncryptionKeyFile != "" {
+		return fmt.Errorf("--encryption-passphrase and --encryption-key-file cannot be used together")
+	}
 
 	if err := config.Save(cfg); err != nil {
 		return err
@@ -48,6 +55,14 @@ func runInit(args []string) error {
 	} else {
 		fmt.Println("  api_key: [empty]")
 	}
+	switch {
+	case cfg.EncryptionPassphrase != "":
+		fmt.Println("  encryption: passphrase")
+	case cfg.EncryptionKeyFile != "":
+		fmt.Println("  encryption: key file", cfg.EncryptionKeyFile)
+	default:
+		fmt.Println("  encryption: [off]")
+	}
 
 	return nil
 }
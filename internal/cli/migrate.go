@@ -88,5 +88,5 @@ func runMigrate(args []string) error {
 		return err
 	}
 
-	return pushAll(cfg, client)
+	return pushAll(cfg, client, false)
 }
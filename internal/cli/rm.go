@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/juliuswalton/scrbl/internal/config"
+	"github.com/juliuswalton/scrbl/internal/dayfiles"
+	syncclient "github.com/juliuswalton/scrbl/sync"
+)
+
+// runRm deletes a day locally and on the server. The server keeps a
+// tombstone, so other machines delete the day on their next `scrbl sync`.
+func runRm(args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	date := fs.String("date", "", "date to delete (YYYY-MM-DD)")
+	force := fs.Bool("force", false, "delete on the server even if it changed since last sync")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("rm does not take positional arguments")
+	}
+	if strings.TrimSpace(*date) == "" {
+		return fmt.Errorf("--date is required")
+	}
+
+	day, err := dayfiles.ParseDateOrToday(*date)
+	if err != nil {
+		return err
+	}
+	key := day.Format(dayfiles.DateLayout)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	client, err := newSyncClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, statErr := os.Stat(dayfiles.Path(cfg.NotesDir, day))
+	existsLocal := statErr == nil
+	if !existsLocal && client == nil {
+		return fmt.Errorf("local note not found for %s", key)
+	}
+
+	if client != nil {
+		var err error
+		if *force {
+			err = client.ForceDeleteNote(day)
+		} else {
+			err = client.DeleteNote(day)
+		}
+		if syncclient.IsConflict(err) {
+			return fmt.Errorf("%w\n  run `scrbl sync pull --date %s` to review it, or delete again with --force", err, key)
+		}
+		if err != nil {
+			if !existsLocal {
+				return err
+			}
+			// The sync state still lists the day, so `scrbl sync` sends the
+			// deletion once the server is reachable.
+			fmt.Fprintf(os.Stderr, "server delete failed: %v\n", err)
+			fmt.Fprintln(os.Stderr, "deleted locally only; run `scrbl sync` later to delete it on the server")
+		}
+	}
+
+	if err := dayfiles.Remove(cfg.NotesDir, day); err != nil {
+		return err
+	}
+	if client != nil {
+		if err := client.Outbox.Remove(key); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("deleted %s\n", key)
+	return nil
+}
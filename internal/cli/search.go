@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/juliuswalton/scrbl/internal/config"
+	"github.com/juliuswalton/scrbl/internal/dayfiles"
+)
+
+var searchMarkRegex = regexp.MustCompile(`</?mark>`)
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	useRegex := fs.Bool("regex", false, "treat the query as a regular expression")
+	ignoreCase := fs.Bool("i", false, "ignore case (default: smart case, sensitive only if the query has uppercase)")
+	caseSensitive := fs.Bool("case-sensitive", false, "always match case")
+	from := fs.String("from", "", "only search days on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only search days on or before this date (YYYY-MM-DD)")
+	contextLines := fs.Int("C", 0, "lines of context around each match")
+	before := fs.Int("B", 0, "lines of context before each match")
+	after := fs.Int("A", 0, "lines of context after each match")
+	remote := fs.Bool("remote", false, "search on the server instead of local files (FTS5 query syntax)")
+
+	// Allow flags after the query, as in: scrbl search deploy -C 2
+	var terms []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		terms = append(terms, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	query := strings.TrimSpace(strings.Join(terms, " "))
+	if query == "" {
+		return fmt.Errorf("missing search query")
+	}
+	if *ignoreCase && *caseSensitive {
+		return fmt.Errorf("-i and --case-sensitive cannot be used together")
+	}
+
+	fromDay, err := parseOptionalDate(*from)
+	if err != nil {
+		return err
+	}
+	toDay, err := parseOptionalDate(*to)
+	if err != nil {
+		return err
+	}
+
+	if *remote {
+		if *useRegex {
+			return fmt.Errorf("--regex is not supported with --remote")
+		}
+		return searchRemote(query, strings.TrimSpace(*from), strings.TrimSpace(*to))
+	}
+
+	pattern := query
+	if !*useRegex {
+		pattern = regexp.QuoteMeta(query)
+	}
+	fold := *ignoreCase || (!*caseSensitive && !hasUpper(query))
+	if fold {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regex: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	dates, err := dayfiles.ListDates(cfg.NotesDir)
+	if err != nil {
+		return err
+	}
+
+	b := max(*before, *contextLines)
+	a := max(*after, *contextLines)
+	days := 0
+	hits := 0
+
+	for _, day := range dates {
+		if !fromDay.IsZero() && day.Before(fromDay) {
+			continue
+		}
+		if !toDay.IsZero() && day.After(toDay) {
+			continue
+		}
+
+		content, err := dayfiles.Read(cfg.NotesDir, day)
+		if err != nil {
+			return err
+		}
+
+		lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+		matched := make([]bool, len(lines))
+		count := 0
+		for i, line := range lines {
+			if re.MatchString(line) {
+				matched[i] = true
+				count++
+			}
+		}
+		if count == 0 {
+			continue
+		}
+
+		if days > 0 {
+			fmt.Println()
+		}
+		fmt.Println(day.Format(dayfiles.DateLayout))
+		printMatches(lines, matched, b, a)
+
+		days++
+		hits += count
+	}
+
+	if days == 0 {
+		fmt.Println("no matches")
+		return nil
+	}
+	fmt.Printf("\n%d matching lines in %d days\n", hits, days)
+	return nil
+}
+
+// printMatches prints matching lines grep-style: "N:" for matches, "N-" for
+// context, and "--" between separated groups.
+func printMatches(lines []string, matched []bool, before, after int) {
+	show := make([]bool, len(lines))
+	for i := range lines {
+		if !matched[i] {
+			continue
+		}
+		for j := max(0, i-before); j <= min(len(lines)-1, i+after); j++ {
+			show[j] = true
+		}
+	}
+
+	last := -1
+	for i, line := range lines {
+		if !show[i] {
+			continue
+		}
+		if last >= 0 && i > last+1 {
+			fmt.Println("  --")
+		}
+		sep := "-"
+		if matched[i] {
+			sep = ":"
+		}
+		fmt.Printf("  %4d%s %s\n", i+1, sep, line)
+		last = i
+	}
+}
+
+func searchRemote(query, from, to string) error {
+	_, client, err := loadSyncClient()
+	if err != nil {
+		return err
+	}
+
+	found := 0
+	for r, err := range client.SearchAll(context.Background(), query, from, to) {
+		if err != nil {
+			return err
+		}
+		if found > 0 {
+			fmt.Println()
+		}
+		found++
+		fmt.Printf("%s  (%d matches)\n", r.Date, len(r.Matches))
+		snippet := searchMarkRegex.ReplaceAllStringFunc(r.Snippet, func(tag string) string {
+			if tag == "<mark>" {
+				return "["
+			}
+			return "]"
+		})
+		for _, line := range strings.Split(strings.TrimSpace(snippet), "\n") {
+			fmt.Println("  " + line)
+		}
+	}
+
+	if found == 0 {
+		fmt.Println("no matches")
+	}
+	return nil
+}
+
+func parseOptionalDate(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return dayfiles.ParseDateOrToday(raw)
+}
+
+func hasUpper(s string) bool {
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliuswalton/scrbl/internal/dayfiles"
+	syncclient "github.com/juliuswalton/scrbl/sync"
+)
+
+// runShare creates a public link to one day on the server, or revokes one.
+func runShare(args []string) error {
+	fs := flag.NewFlagSet("share", flag.ContinueOnError)
+	date := fs.String("date", "", "date to share (YYYY-MM-DD), default today")
+	expires := fs.String("expires", "", "how long the link works, e.g. 7d or 12h (default: until revoked)")
+	revoke := fs.String("revoke", "", "revoke the link with this token instead")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("share does not take positional arguments")
+	}
+
+	_, client, err := loadSyncClient()
+	if err != nil {
+		return err
+	}
+
+	if *revoke != "" {
+		token := *revoke
+		// Accept the whole link as printed, too.
+		if i := strings.LastIndex(token, "/s/"); i >= 0 {
+			token = token[i+len("/s/"):]
+		}
+		if err := client.RevokeShare(context.Background(), token); err != nil {
+			return err
+		}
+		fmt.Println("revoked")
+		return nil
+	}
+
+	day, err := dayfiles.ParseDateOrToday(*date)
+	if err != nil {
+		return err
+	}
+
+	var until time.Time
+	if *expires != "" {
+		d, err := parseExpiry(*expires)
+		if err != nil {
+			return err
+		}
+		until = time.Now().Add(d)
+	}
+
+	share, err := client.ShareNote(context.Background(), day, until)
+	if errors.Is(err, syncclient.ErrNoteNotFound) {
+		key := day.Format(dayfiles.DateLayout)
+		return fmt.Errorf("%s is not on the server (run: scrbl sync push --date %s)", key, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(client.ShareURL(share))
+	if share.ExpiresAt != "" {
+		fmt.Printf("expires %s; revoke with: scrbl share --revoke %s\n", share.ExpiresAt, share.Token)
+	} else {
+		fmt.Printf("revoke with: scrbl share --revoke %s\n", share.Token)
+	}
+	return nil
+}
+
+// parseExpiry parses a link lifetime: a number of days such as 7d, or any
+// time.ParseDuration value such as 12h.
+func parseExpiry(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid --expires %q, expected e.g. 7d or 12h", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid --expires %q, expected e.g. 7d or 12h", s)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("--expires must be positive")
+	}
+	return d, nil
+}
@@ -10,12 +10,13 @@ import (
 
 	"github.com/juliuswalton/scrbl/internal/config"
 	"github.com/juliuswalton/scrbl/internal/dayfiles"
+	"github.com/juliuswalton/scrbl/notes"
 	syncclient "github.com/juliuswalton/scrbl/sync"
 )
 
 func runSync(args []string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("missing sync subcommand (supported: push, pull)")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runSyncReconcile(args)
 	}
 
 	switch args[0] {
@@ -32,6 +33,7 @@ func runSyncPush(args []string) error {
 	fs := flag.NewFlagSet("sync push", flag.ContinueOnError)
 	date := fs.String("date", "", "date to sync (YYYY-MM-DD), default today")
 	all := fs.Bool("all", false, "push all local day files")
+	force := fs.Bool("force", false, "overwrite remote changes instead of reporting conflicts")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -47,9 +49,10 @@ func runSyncPush(args []string) error {
 	if err != nil {
 		return err
 	}
+	drainOutbox(cfg, client)
 
 	if *all {
-		return pushAll(cfg, client)
+		return pushAll(cfg, client, *force)
 	}
 
 	day, err := dayfiles.ParseDateOrToday(*date)
@@ -65,7 +68,13 @@ func runSyncPush(args []string) error {
 		return err
 	}
 
-	if err := client.PushNote(day, content); err != nil {
+	if err := pushAssets(cfg, client, content); err != nil {
+		return err
+	}
+	if err := pushNote(client, day, content, *force); err != nil {
+		if syncclient.IsConflict(err) {
+			return fmt.Errorf("%w\n  run `scrbl sync pull --date %s` to fetch it, or push again with --force to overwrite", err, day.Format(dayfiles.DateLayout))
+		}
 		return err
 	}
 
@@ -92,6 +101,8 @@ func runSyncPull(args []string) error {
 	if err != nil {
 		return err
 	}
+	// Push queued local edits first so the pull cannot overwrite them.
+	drainOutbox(cfg, client)
 
 	if *all {
 		return pullAll(cfg, client)
@@ -115,6 +126,244 @@ func runSyncPull(args []string) error {
 	}
 
 	fmt.Printf("pulled %s\n", day.Format(dayfiles.DateLayout))
+	if _, failed := fetchAssets(cfg, client, content); failed > 0 {
+		return fmt.Errorf("%d attachments failed to download", failed)
+	}
+	return nil
+}
+
+// runSyncReconcile pushes days changed locally and pulls days changed on the
+// server since the last sync, using the hashes and revisions in the sync state
+// file to tell the two apart. Deletions travel the same way: a synced day whose
+// file is gone is deleted on the server, and a server tombstone removes the
+// local file. Days changed on both sides are left alone and reported as
+// conflicts.
+func runSyncReconcile(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "show what would be pushed and pulled without changing anything")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("sync does not take positional arguments")
+	}
+
+	cfg, client, err := loadSyncClient()
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		drainOutbox(cfg, client)
+	}
+	state := client.State
+
+	remoteNotes, err := client.PullUpdatedSince(state.SinceCursor())
+	if err != nil {
+		return err
+	}
+
+	newest := ""
+	remote := make(map[string]syncclient.RemoteNote, len(remoteNotes))
+	for _, n := range remoteNotes {
+		if n.UpdatedAt > newest {
+			newest = n.UpdatedAt
+		}
+		if _, err := time.Parse(dayfiles.DateLayout, n.Date); err != nil {
+			fmt.Fprintf(os.Stderr, "skip %s: invalid date from server\n", n.Date)
+			continue
+		}
+		// Our own earlier pushes come back through ?since= too.
+		if last, ok := state.Note(n.Date); ok && last.Revision == n.Revision {
+			continue
+		}
+		remote[n.Date] = n
+	}
+
+	localDates, err := dayfiles.ListDates(cfg.NotesDir)
+	if err != nil {
+		return err
+	}
+
+	local := make(map[string]string)
+	present := make(map[string]bool, len(localDates))
+	// Notes whose linked assets may need fetching, including days synced
+	// earlier, e.g. by the TUI, which does not handle attachments.
+	var linking []string
+	for _, day := range localDates {
+		key := day.Format(dayfiles.DateLayout)
+		present[key] = true
+		content, err := dayfiles.Read(cfg.NotesDir, day)
+		if err != nil {
+			return err
+		}
+		if len(dayfiles.AssetRefs(content)) > 0 {
+			linking = append(linking, content)
+		}
+		if last, ok := state.Note(key); ok && last.Hash == syncclient.ContentHash(content) {
+			continue
+		}
+		local[key] = content
+	}
+
+	// Days synced before whose file is gone were deleted locally.
+	deletedLocal := make(map[string]bool)
+	for _, key := range state.SyncedDates() {
+		if !present[key] {
+			deletedLocal[key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(remote)+len(local)+len(deletedLocal))
+	for key := range remote {
+		keys = append(keys, key)
+	}
+	for key := range local {
+		if _, ok := remote[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for key := range deletedLocal {
+		if _, ok := remote[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	pulled := 0
+	pushed := 0
+	deleted := 0
+	conflicts := 0
+	failed := 0
+	var toPush []syncclient.LocalNote
+
+	for _, key := range keys {
+		day, _ := time.Parse(dayfiles.DateLayout, key)
+		rn, remoteChanged := remote[key]
+		content, localChanged := local[key]
+		localDeleted := deletedLocal[key]
+
+		switch {
+		case remoteChanged && rn.Deleted && localChanged:
+			fmt.Fprintf(os.Stderr, "conflict %s: deleted on the server but changed locally\n", key)
+			conflicts++
+
+		case remoteChanged && rn.Deleted:
+			if *dryRun {
+				fmt.Printf("would delete %s locally\n", key)
+				deleted++
+				continue
+			}
+			if err := dayfiles.Remove(cfg.NotesDir, day); err != nil {
+				fmt.Fprintf(os.Stderr, "fail %s: %v\n", key, err)
+				failed++
+				continue
+			}
+			if err := client.RecordSynced(rn); err != nil {
+				return err
+			}
+			fmt.Printf("deleted %s locally\n", key)
+			deleted++
+
+		case remoteChanged && localDeleted:
+			fmt.Fprintf(os.Stderr, "conflict %s: deleted locally but changed on the server\n", key)
+			conflicts++
+
+		case remoteChanged && localChanged:
+			if rn.Content == content {
+				if !*dryRun {
+					if err := client.RecordSynced(rn); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "conflict %s: changed locally and on the server\n", key)
+			conflicts++
+
+		case remoteChanged:
+			if *dryRun {
+				fmt.Printf("would pull %s\n", key)
+				pulled++
+				continue
+			}
+			if err := dayfiles.Write(cfg.NotesDir, day, rn.Content); err != nil {
+				fmt.Fprintf(os.Stderr, "fail %s: %v\n", key, err)
+				failed++
+				continue
+			}
+			if err := client.RecordSynced(rn); err != nil {
+				return err
+			}
+			fmt.Printf("pulled %s\n", key)
+			pulled++
+			linking = append(linking, rn.Content)
+
+		case localChanged:
+			if *dryRun {
+				fmt.Printf("would push %s\n", key)
+				pushed++
+				continue
+			}
+			toPush = append(toPush, syncclient.LocalNote{Date: day, Content: content})
+
+		case localDeleted:
+			if *dryRun {
+				fmt.Printf("would delete %s on the server\n", key)
+				deleted++
+				continue
+			}
+			if err := client.DeleteNote(day); err != nil {
+				if syncclient.IsConflict(err) {
+					fmt.Fprintf(os.Stderr, "conflict %s: deleted locally but changed on the server\n", key)
+					conflicts++
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "fail %s: %v\n", key, err)
+				failed++
+				continue
+			}
+			fmt.Printf("deleted %s on the server\n", key)
+			deleted++
+		}
+	}
+
+	batchPushed, batchConflicts, batchFailed, err := pushBatch(cfg, client, toPush, false)
+	pushed += batchPushed
+	conflicts += batchConflicts
+	failed += batchFailed
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		fmt.Printf("dry-run complete: %d would pull, %d would push, %d would delete, %d conflicts\n", pulled, pushed, deleted, conflicts)
+		return nil
+	}
+
+	// Conflicted days keep a stale revision in the state file, so they are
+	// caught again by the push on the next run even though the cursor moves.
+	if failed == 0 {
+		if err := state.AdvanceSince(newest); err != nil {
+			return err
+		}
+	}
+
+	// Local files are scanned on every run, so a failed download is retried
+	// next time without holding back the cursor.
+	for _, content := range linking {
+		_, assetsFailed := fetchAssets(cfg, client, content)
+		failed += assetsFailed
+	}
+
+	fmt.Printf("sync complete: %d pulled, %d pushed, %d deleted, %d conflicts, %d failed\n", pulled, pushed, deleted, conflicts, failed)
+	if conflicts > 0 {
+		fmt.Println("resolve conflicts with `scrbl sync pull --date <day>` or `scrbl sync push --date <day> --force`")
+	}
+	if failed > 0 || conflicts > 0 {
+		return fmt.Errorf("sync completed with failures")
+	}
+
 	return nil
 }
 
@@ -124,7 +373,10 @@ func loadSyncClient() (config.Config, *syncclient.Client, error) {
 		return config.Config{}, nil, err
 	}
 
-	client := syncclient.NewClient(cfg.ServerURL, cfg.APIKey)
+	client, err := newSyncClient(cfg)
+	if err != nil {
+		return config.Config{}, nil, err
+	}
 	if client == nil {
 		return config.Config{}, nil, fmt.Errorf("server_url is not configured (run: scrbl init --server <url>)")
 	}
@@ -136,7 +388,94 @@ func loadSyncClient() (config.Config, *syncclient.Client, error) {
 	return cfg, client, nil
 }
 
-func pushAll(cfg config.Config, client *syncclient.Client) error {
+// newSyncClient builds a client with its sync state and outbox loaded. It
+// returns nil when no server is configured.
+func newSyncClient(cfg config.Config) (*syncclient.Client, error) {
+	client := syncclient.NewClient(cfg.ServerURL, cfg.APIKey)
+	if client == nil {
+		return nil, nil
+	}
+
+	state, err := syncclient.LoadState(config.SyncStatePath())
+	if err != nil {
+		return nil, err
+	}
+	client.State = state
+
+	outbox, err := syncclient.LoadOutbox(config.OutboxPath())
+	if err != nil {
+		return nil, err
+	}
+	client.Outbox = outbox
+	client.Cache = syncclient.NewCache(config.CacheDir())
+
+	if cfg.EncryptionPassphrase != "" || cfg.EncryptionKeyFile != "" {
+		cipher, err := newCipher(cfg, state)
+		if err != nil {
+			return nil, err
+		}
+		client.Cipher = cipher
+	}
+
+	return client, nil
+}
+
+func newCipher(cfg config.Config, state *syncclient.State) (*syncclient.Cipher, error) {
+	if cfg.EncryptionPassphrase != "" && cfg.EncryptionKeyFile != "" {
+		return nil, fmt.Errorf("set only one of encryption_passphrase and encryption_key_file")
+	}
+
+	salt, err := state.CipherSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.EncryptionKeyFile != "" {
+		return syncclient.NewKeyFileCipher(cfg.EncryptionKeyFile, salt)
+	}
+	return syncclient.NewPassphraseCipher(cfg.EncryptionPassphrase, salt)
+}
+
+// drainOutbox retries pushes that failed earlier, typically while the TUI
+// was offline. An unreachable server is reported but not fatal, so the
+// command that triggered the drain can still run.
+func drainOutbox(cfg config.Config, client *syncclient.Client) {
+	if client.Outbox.Len() == 0 {
+		return
+	}
+
+	store := notes.NewStore(cfg.NotesDir)
+	read := func(day time.Time) (string, error) {
+		content, err := store.ReadDay(day)
+		if err != nil {
+			return "", err
+		}
+		return content, pushAssets(cfg, client, content)
+	}
+	res, err := client.DrainOutbox(read)
+	for _, date := range res.Conflicts {
+		fmt.Fprintf(os.Stderr, "conflict %s: queued change conflicts with the server copy\n", date)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "outbox: %v (%d pending)\n", err, res.Remaining)
+		return
+	}
+	if res.Pushed > 0 {
+		fmt.Printf("outbox: pushed %d queued days\n", res.Pushed)
+	}
+	if res.Remaining > 0 {
+		fmt.Fprintf(os.Stderr, "outbox: %d still pending\n", res.Remaining)
+	}
+}
+
+func pushNote(client *syncclient.Client, day time.Time, content string, force bool) error {
+	if force {
+		return client.ForcePushNote(day, content)
+	}
+	return client.PushNote(day, content)
+}
+
+func pushAll(cfg config.Config, client *syncclient.Client, force bool) error {
 	dates, err := dayfiles.ListDates(cfg.NotesDir)
 	if err != nil {
 		return err
@@ -146,8 +485,8 @@ func pushAll(cfg config.Config, client *syncclient.Client) error {
 		return nil
 	}
 
-	pushed := 0
 	failed := 0
+	batch := make([]syncclient.LocalNote, 0, len(dates))
 
 	for _, day := range dates {
 		content, err := dayfiles.Read(cfg.NotesDir, day)
@@ -156,67 +495,104 @@ func pushAll(cfg config.Config, client *syncclient.Client) error {
 			failed++
 			continue
 		}
+		batch = append(batch, syncclient.LocalNote{Date: day, Content: content})
+	}
 
-		if err := client.PushNote(day, content); err != nil {
-			fmt.Fprintf(os.Stderr, "fail %s: %v\n", day.Format(dayfiles.DateLayout), err)
+	pushed, conflicts, batchFailed, err := pushBatch(cfg, client, batch, force)
+	failed += batchFailed
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("push complete: %d pushed, %d conflicts, %d failed\n", pushed, conflicts, failed)
+	if conflicts > 0 {
+		fmt.Println("conflicting days were not pushed; pull them first or push again with --force")
+	}
+	if failed > 0 || conflicts > 0 {
+		return fmt.Errorf("push completed with failures")
+	}
+
+	return nil
+}
+
+// pushBatch pushes notes through the batch endpoint and prints one line per
+// day. Each note's attachments are uploaded first; a day whose upload fails
+// is not pushed. err is only set when the server could not be reached at all.
+func pushBatch(cfg config.Config, client *syncclient.Client, batch []syncclient.LocalNote, force bool) (pushed, conflicts, failed int, err error) {
+	ready := batch[:0:0]
+	for _, n := range batch {
+		if err := pushAssets(cfg, client, n.Content); err != nil {
+			fmt.Fprintf(os.Stderr, "fail %s: %v\n", n.Date.Format(dayfiles.DateLayout), err)
 			failed++
 			continue
 		}
-
-		fmt.Printf("pushed %s\n", day.Format(dayfiles.DateLayout))
-		pushed++
+		ready = append(ready, n)
+	}
+	if len(ready) == 0 {
+		return 0, 0, failed, nil
 	}
 
-	fmt.Printf("push complete: %d pushed, %d failed\n", pushed, failed)
-	if failed > 0 {
-		return fmt.Errorf("push completed with failures")
+	results, err := client.PushNotes(ready, force)
+	for _, r := range results {
+		switch {
+		case r.Err == nil:
+			fmt.Printf("pushed %s\n", r.Date)
+			pushed++
+		case syncclient.IsConflict(r.Err):
+			fmt.Fprintf(os.Stderr, "conflict %s: remote note changed since last sync\n", r.Date)
+			conflicts++
+		default:
+			fmt.Fprintf(os.Stderr, "fail %s: %v\n", r.Date, r.Err)
+			failed++
+		}
 	}
 
-	return nil
+	return pushed, conflicts, failed, err
 }
 
 func pullAll(cfg config.Config, client *syncclient.Client) error {
-	dateStrings, err := client.PullAllDates()
+	remoteNotes, err := client.PullAllNotes()
 	if err != nil {
 		return err
 	}
-	if len(dateStrings) == 0 {
+	if len(remoteNotes) == 0 {
 		fmt.Println("no remote day files to pull")
 		return nil
 	}
 
-	sort.Strings(dateStrings)
+	sort.Slice(remoteNotes, func(i, j int) bool {
+		return remoteNotes[i].Date < remoteNotes[j].Date
+	})
 	pulled := 0
 	skipped := 0
 	failed := 0
 
-	for _, ds := range dateStrings {
-		day, err := time.Parse(dayfiles.DateLayout, ds)
+	for _, n := range remoteNotes {
+		day, err := time.Parse(dayfiles.DateLayout, n.Date)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "skip %s: invalid date from server\n", ds)
+			fmt.Fprintf(os.Stderr, "skip %s: invalid date from server\n", n.Date)
 			skipped++
 			continue
 		}
-
-		content, err := client.PullNote(day)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "fail %s: %v\n", ds, err)
-			failed++
-			continue
-		}
-		if content == "" {
+		if n.Content == "" {
 			skipped++
 			continue
 		}
 
-		if err := dayfiles.Write(cfg.NotesDir, day, content); err != nil {
-			fmt.Fprintf(os.Stderr, "fail %s: %v\n", ds, err)
+		if err := dayfiles.Write(cfg.NotesDir, day, n.Content); err != nil {
+			fmt.Fprintf(os.Stderr, "fail %s: %v\n", n.Date, err)
 			failed++
 			continue
 		}
+		if err := client.RecordSynced(n); err != nil {
+			return err
+		}
 
-		fmt.Printf("pulled %s\n", ds)
+		fmt.Printf("pulled %s\n", n.Date)
 		pulled++
+
+		_, assetsFailed := fetchAssets(cfg, client, n.Content)
+		failed += assetsFailed
 	}
 
 	fmt.Printf("pull complete: %d pulled, %d skipped, %d failed\n", pulled, skipped, failed)
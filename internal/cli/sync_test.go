@@ -0,0 +1,337 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+	"github.com/juliuswalton/scrbl-server/apiv1/apitest"
+	"github.com/juliuswalton/scrbl/internal/config"
+	"github.com/juliuswalton/scrbl/internal/dayfiles"
+	syncclient "github.com/juliuswalton/scrbl/sync"
+)
+
+// syncServer is an in-memory server with just the endpoints scrbl sync
+// uses. Notes in reject fail their batch push.
+type syncServer struct {
+	mu     gosync.Mutex
+	notes  map[string]apiv1.Note
+	reject map[string]bool
+	clock  time.Time
+}
+
+func newSyncServer() *syncServer {
+	return &syncServer{
+		notes:  map[string]apiv1.Note{},
+		reject: map[string]bool{},
+		clock:  time.Date(2026, 2, 17, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func (f *syncServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/notes", f.list)
+	mux.HandleFunc("POST /api/notes/batch", f.batch)
+	mux.HandleFunc("DELETE /api/notes/{date}", f.delete)
+	return mux
+}
+
+// write stores a note as the next revision. Callers hold f.mu.
+func (f *syncServer) write(date, content string, deleted bool) apiv1.Note {
+	f.clock = f.clock.Add(time.Minute)
+	n := apiv1.Note{
+		Date:      date,
+		Content:   content,
+		Revision:  f.notes[date].Revision + 1,
+		UpdatedAt: f.clock.Format(time.RFC3339),
+		Deleted:   deleted,
+	}
+	f.notes[date] = n
+	return n
+}
+
+func (f *syncServer) put(date, content string, deleted bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.write(date, content, deleted)
+}
+
+func (f *syncServer) list(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	since := r.URL.Query().Get("since")
+	notes := []apiv1.Note{}
+	for _, n := range f.notes {
+		if n.UpdatedAt >= since {
+			notes = append(notes, n)
+		}
+	}
+	slices.SortFunc(notes, func(a, b apiv1.Note) int { return strings.Compare(b.Date, a.Date) })
+	writeTestJSON(w, http.StatusOK, apiv1.Page[apiv1.Note]{Items: notes})
+}
+
+func (f *syncServer) batch(w http.ResponseWriter, r *http.Request) {
+	var req apiv1.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := apiv1.BatchResponse{Results: []apiv1.BatchResult{}}
+	for _, n := range req.Notes {
+		current := f.notes[n.Date]
+		switch {
+		case f.reject[n.Date]:
+			resp.Results = append(resp.Results, apiv1.BatchResult{Date: n.Date, Status: apiv1.BatchError, Error: "rejected"})
+		case n.BaseRevision != nil && *n.BaseRevision != current.Revision:
+			resp.Results = append(resp.Results, apiv1.BatchResult{Date: n.Date, Status: apiv1.BatchConflict, Note: &current})
+		default:
+			note := f.write(n.Date, n.Content, false)
+			resp.Results = append(resp.Results, apiv1.BatchResult{Date: n.Date, Status: apiv1.BatchOK, Note: &note})
+		}
+	}
+	writeTestJSON(w, http.StatusOK, resp)
+}
+
+func (f *syncServer) delete(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	date := r.PathValue("date")
+	current, ok := f.notes[date]
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if raw := r.URL.Query().Get("base_revision"); raw != "" {
+		if base, _ := strconv.ParseInt(raw, 10, 64); base != current.Revision {
+			writeTestJSON(w, http.StatusConflict, current)
+			return
+		}
+	}
+	writeTestJSON(w, http.StatusOK, f.write(date, "", true))
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// deleted stands for a tombstone on the server, or a missing day file.
+const deleted = "<deleted>"
+
+// TestSyncReconcile runs `scrbl sync` twice: once to agree on a starting
+// point, then again after changing days locally and on the server.
+func TestSyncReconcile(t *testing.T) {
+	const (
+		day1 = "2026-02-16"
+		day2 = "2026-02-17"
+	)
+
+	tests := []struct {
+		name string
+		// Days on disk before the first sync.
+		local map[string]string
+		// change edits both sides between the two syncs; "" removes a file.
+		change  func(f *syncServer, local map[string]string)
+		reject  []string
+		wantErr bool
+		// Both sides after the second sync; deleted means a tombstone or no
+		// file.
+		wantServer, wantLocal map[string]string
+		wantSinceMoved        bool
+	}{
+		{
+			name:       "local only",
+			change:     func(f *syncServer, local map[string]string) { local[day1] = "mine\n" },
+			wantServer: map[string]string{day1: "mine\n"},
+			wantLocal:  map[string]string{day1: "mine\n"},
+		},
+		{
+			name:           "remote only",
+			change:         func(f *syncServer, local map[string]string) { f.put(day1, "theirs\n", false) },
+			wantServer:     map[string]string{day1: "theirs\n"},
+			wantLocal:      map[string]string{day1: "theirs\n"},
+			wantSinceMoved: true,
+		},
+		{
+			name:  "both changed the same way",
+			local: map[string]string{day1: "old\n"},
+			change: func(f *syncServer, local map[string]string) {
+				f.put(day1, "same\n", false)
+				local[day1] = "same\n"
+			},
+			wantServer:     map[string]string{day1: "same\n"},
+			wantLocal:      map[string]string{day1: "same\n"},
+			wantSinceMoved: true,
+		},
+		{
+			name:  "both changed differently",
+			local: map[string]string{day1: "old\n", day2: "other\n"},
+			change: func(f *syncServer, local map[string]string) {
+				f.put(day1, "theirs\n", false)
+				local[day1] = "mine\n"
+				local[day2] = "other, edited\n"
+			},
+			wantErr:        true,
+			wantServer:     map[string]string{day1: "theirs\n", day2: "other, edited\n"},
+			wantLocal:      map[string]string{day1: "mine\n", day2: "other, edited\n"},
+			wantSinceMoved: true,
+		},
+		{
+			name:           "deleted on the server",
+			local:          map[string]string{day1: "old\n"},
+			change:         func(f *syncServer, local map[string]string) { f.put(day1, "", true) },
+			wantServer:     map[string]string{day1: deleted},
+			wantLocal:      map[string]string{day1: deleted},
+			wantSinceMoved: true,
+		},
+		{
+			name:       "deleted locally",
+			local:      map[string]string{day1: "old\n"},
+			change:     func(f *syncServer, local map[string]string) { local[day1] = "" },
+			wantServer: map[string]string{day1: deleted},
+			wantLocal:  map[string]string{day1: deleted},
+			// The first sync's own push is now behind the cursor.
+			wantSinceMoved: true,
+		},
+		{
+			name:  "deleted on the server, changed locally",
+			local: map[string]string{day1: "old\n"},
+			change: func(f *syncServer, local map[string]string) {
+				f.put(day1, "", true)
+				local[day1] = "mine\n"
+			},
+			wantErr:        true,
+			wantServer:     map[string]string{day1: deleted},
+			wantLocal:      map[string]string{day1: "mine\n"},
+			wantSinceMoved: true,
+		},
+		{
+			name:  "deleted locally, changed on the server",
+			local: map[string]string{day1: "old\n"},
+			change: func(f *syncServer, local map[string]string) {
+				f.put(day1, "theirs\n", false)
+				local[day1] = ""
+			},
+			wantErr:        true,
+			wantServer:     map[string]string{day1: "theirs\n"},
+			wantLocal:      map[string]string{day1: deleted},
+			wantSinceMoved: true,
+		},
+		{
+			name: "failed push holds the cursor",
+			change: func(f *syncServer, local map[string]string) {
+				f.put(day2, "theirs\n", false)
+				local[day1] = "mine\n"
+			},
+			reject:         []string{day1},
+			wantErr:        true,
+			wantServer:     map[string]string{day1: deleted, day2: "theirs\n"},
+			wantLocal:      map[string]string{day1: "mine\n", day2: "theirs\n"},
+			wantSinceMoved: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			notesDir := filepath.Join(dir, "notes")
+			t.Setenv("SCRBL_CONFIG", filepath.Join(dir, "config.json"))
+
+			f := newSyncServer()
+			ts := httptest.NewServer(apitest.Default().Check(t, f.handler()))
+			defer ts.Close()
+
+			if err := config.Save(config.Config{NotesDir: notesDir, ServerURL: ts.URL, APIKey: "scrbl_test"}); err != nil {
+				t.Fatal(err)
+			}
+			writeDays(t, notesDir, tt.local)
+			if err := runSyncReconcile(nil); err != nil {
+				t.Fatalf("first sync: %v", err)
+			}
+			since := loadSince(t)
+
+			local := map[string]string{}
+			tt.change(f, local)
+			writeDays(t, notesDir, local)
+			for _, date := range tt.reject {
+				f.reject[date] = true
+			}
+
+			err := runSyncReconcile(nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("second sync = %v, want error %v", err, tt.wantErr)
+			}
+
+			for _, date := range []string{day1, day2} {
+				day, _ := time.Parse(dayfiles.DateLayout, date)
+				got, err := dayfiles.Read(notesDir, day)
+				if os.IsNotExist(err) {
+					got = deleted
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				if want, ok := tt.wantLocal[date]; ok && got != want {
+					t.Errorf("local %s = %q, want %q", date, got, want)
+				}
+
+				n, ok := f.notes[date]
+				got = n.Content
+				if !ok || n.Deleted {
+					got = deleted
+				}
+				if want, ok := tt.wantServer[date]; ok && got != want {
+					t.Errorf("server %s = %q, want %q", date, got, want)
+				}
+			}
+
+			if moved := loadSince(t) != since; moved != tt.wantSinceMoved {
+				t.Errorf("since cursor moved = %v, want %v", moved, tt.wantSinceMoved)
+			}
+		})
+	}
+}
+
+// writeDays writes day files, removing those whose content is empty.
+func writeDays(t *testing.T, notesDir string, days map[string]string) {
+	t.Helper()
+
+	for date, content := range days {
+		day, err := time.Parse(dayfiles.DateLayout, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content == "" {
+			err = dayfiles.Remove(notesDir, day)
+		} else {
+			err = dayfiles.Write(notesDir, day, content)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func loadSince(t *testing.T) string {
+	t.Helper()
+
+	state, err := syncclient.LoadState(config.SyncStatePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state.SinceCursor()
+}
@@ -9,7 +9,6 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/juliuswalton/scrbl/internal/config"
 	"github.com/juliuswalton/scrbl/notes"
-	syncclient "github.com/juliuswalton/scrbl/sync"
 	"github.com/juliuswalton/scrbl/tui"
 )
 
@@ -38,7 +37,10 @@ func runTUI(args []string) error {
 	}
 
 	store := notes.NewStore(cfg.NotesDir)
-	syncer := syncclient.NewClient(cfg.ServerURL, cfg.APIKey)
+	syncer, err := newSyncClient(cfg)
+	if err != nil {
+		return err
+	}
 	app := tui.NewApp(store, syncer, ed)
 
 	p := tea.NewProgram(app, tea.WithAltScreen())
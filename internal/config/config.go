@@ -11,12 +11,19 @@ import (
 const (
 	defaultConfigFile = "config.json"
 	legacyConfigFile  = "config.yaml"
+	syncStateFile     = "sync_state.json"
+	outboxFile        = "outbox.json"
+	cacheDir          = "cache"
 )
 
 type Config struct {
 	NotesDir  string `json:"notes_dir"`
 	ServerURL string `json:"server_url"`
 	APIKey    string `json:"api_key"`
+
+	// Optional end-to-end encryption of synced notes. Set at most one.
+	EncryptionPassphrase string `json:"encryption_passphrase,omitempty"`
+	EncryptionKeyFile    string `json:"encryption_key_file,omitempty"`
 }
 
 func Load() (Config, error) {
@@ -79,6 +86,24 @@ func Path() string {
 	return filepath.Join(baseDir(), defaultConfigFile)
 }
 
+// SyncStatePath returns the file used to track per-day sync revisions. It
+// lives beside the config file.
+func SyncStatePath() string {
+	return filepath.Join(filepath.Dir(Path()), syncStateFile)
+}
+
+// OutboxPath returns the file holding days whose push failed and must be
+// retried. It lives beside the config file.
+func OutboxPath() string {
+	return filepath.Join(filepath.Dir(Path()), outboxFile)
+}
+
+// CacheDir returns the directory of cached server responses used for
+// conditional requests. It lives beside the config file.
+func CacheDir() string {
+	return filepath.Join(filepath.Dir(Path()), cacheDir)
+}
+
 func DefaultNotesDir() string {
 	return filepath.Join(baseDir(), "notes")
 }
@@ -132,6 +157,7 @@ func finalize(cfg Config) Config {
 	cfg.NotesDir = expandPath(cfg.NotesDir)
 	cfg.ServerURL = strings.TrimRight(strings.TrimSpace(cfg.ServerURL), "/")
 	cfg.APIKey = strings.TrimSpace(cfg.APIKey)
+	cfg.EncryptionKeyFile = expandPath(cfg.EncryptionKeyFile)
 
 	return cfg
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -50,6 +51,14 @@ func Write(notesDir string, day time.Time, content string) error {
 	return nil
 }
 
+// Remove deletes a day file. A missing file is not an error.
+func Remove(notesDir string, day time.Time) error {
+	if err := os.Remove(Path(notesDir, day)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove day file: %w", err)
+	}
+	return nil
+}
+
 func ListDates(notesDir string) ([]time.Time, error) {
 	entries, err := os.ReadDir(notesDir)
 	if err != nil {
@@ -83,3 +92,62 @@ func ListDates(notesDir string) ([]time.Time, error) {
 
 	return dates, nil
 }
+
+// AssetsDir is the folder beside the day files that holds attachments. Each
+// is named by the SHA-256 of its content plus the original extension, and
+// notes link to it relative to the day file.
+const AssetsDir = "assets"
+
+var assetRef = regexp.MustCompile(`\]\(` + AssetsDir + `/([0-9a-f]{64}(?:\.[A-Za-z0-9]+)?)\)`)
+
+// AssetName returns the assets file name for content with the given hash,
+// keeping the extension of the original file name.
+func AssetName(hash, original string) string {
+	return hash + strings.ToLower(filepath.Ext(original))
+}
+
+func AssetPath(notesDir, name string) string {
+	return filepath.Join(notesDir, AssetsDir, name)
+}
+
+// AssetHash returns the content hash an asset file name starts with.
+func AssetHash(name string) string {
+	hash, _, _ := strings.Cut(name, ".")
+	return hash
+}
+
+// WriteAsset stores an attachment in the assets folder. An existing file is
+// left alone, since the name already fixes its content.
+func WriteAsset(notesDir, name string, data []byte) error {
+	path := AssetPath(notesDir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create assets dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write asset: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write asset: %w", err)
+	}
+	return nil
+}
+
+// AssetRefs returns the asset file names linked from a note, in order and
+// without duplicates.
+func AssetRefs(content string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range assetRef.FindAllStringSubmatch(content, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
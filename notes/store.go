@@ -53,6 +53,14 @@ func (s *Store) WriteDay(day time.Time, content string) error {
 	return os.WriteFile(s.PathForDate(day), []byte(content), 0o644)
 }
 
+func (s *Store) RemoveDay(day time.Time) error {
+	err := os.Remove(s.PathForDate(day))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (s *Store) AppendEntry(day time.Time, content string) error {
 	if err := s.EnsureDir(); err != nil {
 		return err
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/store"
+)
+
+// runAdmin handles `scrbl-server admin ...`. Admin commands open the database
+// directly and do not need the server to be running.
+func runAdmin(args []string) error {
+	if len(args) == 0 {
+		printAdminUsage()
+		return fmt.Errorf("missing admin command")
+	}
+
+	switch args[0] {
+	case "users":
+		return runAdminUsers(args[1:])
+	case "keys":
+		return runAdminKeys(args[1:])
+	case "export":
+		return runAdminExport(args[1:])
+	case "import":
+		return runAdminImport(args[1:])
+	case "help", "-h", "--help":
+		printAdminUsage()
+		return nil
+	default:
+		printAdminUsage()
+		return fmt.Errorf("unknown admin command %q", args[0])
+	}
+}
+
+func runAdminUsers(args []string) error {
+	if len(args) == 0 {
+		printAdminUsage()
+		return fmt.Errorf("missing users command")
+	}
+
+	switch args[0] {
+	case "add":
+		return runAdminUsersAdd(args[1:])
+	case "list":
+		return runAdminUsersList(args[1:])
+	default:
+		printAdminUsage()
+		return fmt.Errorf("unknown users command %q", args[0])
+	}
+}
+
+func runAdminUsersAdd(args []string) error {
+	fs, dbPath := adminFlagSet("users add")
+	scopeList := scopesFlag(fs)
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: scrbl-server admin users add [-scopes list] <name>")
+	}
+	scopes, err := store.ParseScopes(*scopeList)
+	if err != nil {
+		return err
+	}
+
+	s, err := store.New(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	user, err := s.CreateUser(positional[0])
+	if errors.Is(err, store.ErrUserExists) {
+		return fmt.Errorf("user %q already exists", positional[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	key, err := s.CreateAPIKey(user.ID, scopes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created user %s (id %d)\n", user.Name, user.ID)
+	fmt.Printf("api key (%s): %s\n", strings.Join(scopes, ","), key)
+	fmt.Println("store the key now; it cannot be shown again")
+	return nil
+}
+
+func runAdminUsersList(args []string) error {
+	fs, dbPath := adminFlagSet("users list")
+	if _, err := parseInterleaved(fs, args); err != nil {
+		return err
+	}
+
+	s, err := store.New(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	users, err := s.ListUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		fmt.Printf("%d\t%s\t%s\n", u.ID, u.Name, u.CreatedAt)
+	}
+	return nil
+}
+
+func runAdminKeys(args []string) error {
+	if len(args) == 0 {
+		printAdminUsage()
+		return fmt.Errorf("missing keys command")
+	}
+
+	switch args[0] {
+	case "create":
+		return runAdminKeysCreate(args[1:])
+	case "list":
+		return runAdminKeysList(args[1:])
+	case "scopes":
+		return runAdminKeysScopes(args[1:])
+	case "revoke":
+		return runAdminKeysRevoke(args[1:])
+	default:
+		printAdminUsage()
+		return fmt.Errorf("unknown keys command %q", args[0])
+	}
+}
+
+func runAdminKeysCreate(args []string) error {
+	fs, dbPath := adminFlagSet("keys create")
+	userName := fs.String("user", "default", "user the key belongs to")
+	scopeList := scopesFlag(fs)
+	if positional, err := parseInterleaved(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return fmt.Errorf("keys create does not take positional arguments")
+	}
+	scopes, err := store.ParseScopes(*scopeList)
+	if err != nil {
+		return err
+	}
+
+	s, err := store.New(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	user, err := lookupUser(s, *userName)
+	if err != nil {
+		return err
+	}
+
+	key, err := s.CreateAPIKey(user.ID, scopes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("api key for %s (%s): %s\n", user.Name, strings.Join(scopes, ","), key)
+	fmt.Println("store the key now; it cannot be shown again")
+	return nil
+}
+
+func runAdminKeysList(args []string) error {
+	fs, dbPath := adminFlagSet("keys list")
+	userName := fs.String("user", "", "only list keys of this user")
+	if positional, err := parseInterleaved(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return fmt.Errorf("keys list does not take positional arguments")
+	}
+
+	s, err := store.New(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var userID int64
+	if *userName != "" {
+		user, err := lookupUser(s, *userName)
+		if err != nil {
+			return err
+		}
+		userID = user.ID
+	}
+
+	keys, err := s.ListAPIKeys(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		status := "active"
+		if k.RevokedAt != "" {
+			status = "revoked " + k.RevokedAt
+		}
+		// Keys registered before prefixes were kept have none.
+		prefix := "-"
+		if k.Prefix != "" {
+			prefix = k.Prefix + "…"
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.User, prefix, strings.Join(k.Scopes, ","), k.CreatedAt, status)
+	}
+	return nil
+}
+
+func runAdminKeysScopes(args []string) error {
+	fs, dbPath := adminFlagSet("keys scopes")
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: scrbl-server admin keys scopes <id> <scopes>")
+	}
+	id, err := strconv.ParseInt(positional[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid key id %q (see: admin keys list)", positional[0])
+	}
+	scopes, err := store.ParseScopes(positional[1])
+	if err != nil {
+		return err
+	}
+
+	s, err := store.New(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.SetAPIKeyScopes(id, scopes); err != nil {
+		if errors.Is(err, store.ErrKeyNotFound) {
+			return fmt.Errorf("no api key with id %d", id)
+		}
+		return err
+	}
+
+	fmt.Printf("api key %d now has scopes %s\n", id, strings.Join(scopes, ","))
+	return nil
+}
+
+func runAdminKeysRevoke(args []string) error {
+	fs, dbPath := adminFlagSet("keys revoke")
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: scrbl-server admin keys revoke <id>")
+	}
+	id, err := strconv.ParseInt(positional[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid key id %q (see: admin keys list)", positional[0])
+	}
+
+	s, err := store.New(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.RevokeAPIKey(id); err != nil {
+		if errors.Is(err, store.ErrKeyNotFound) {
+			return fmt.Errorf("no api key with id %d", id)
+		}
+		return err
+	}
+
+	fmt.Printf("revoked api key %d\n", id)
+	return nil
+}
+
+// runAdminExport writes every note of a user to <dir>/YYYY-MM-DD.md, the
+// same layout the client uses for its notes directory. Encrypted notes are
+// written as stored.
+func runAdminExport(args []string) error {
+	fs, dbPath := adminFlagSet("export")
+	userName := fs.String("user", "default", "user whose notes to export")
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: scrbl-server admin export [-user name] <dir>")
+	}
+	dir := positional[0]
+
+	s, err := store.New(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	user, err := lookupUser(s, *userName)
+	if err != nil {
+		return err
+	}
+
+	notes, err := s.ListNotes(user.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create export dir: %w", err)
+	}
+	for _, n := range notes {
+		if err := os.WriteFile(filepath.Join(dir, n.Date+".md"), []byte(n.Content), 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", n.Date, err)
+		}
+	}
+
+	fmt.Printf("exported %d notes to %s\n", len(notes), dir)
+	return nil
+}
+
+// runAdminImport reads <dir>/YYYY-MM-DD.md files into a user's notebook.
+// Each changed file becomes a new revision, so an import can be undone from
+// the history; files matching the stored note are skipped.
+func runAdminImport(args []string) error {
+	fs, dbPath := adminFlagSet("import")
+	userName := fs.String("user", "default", "user whose notebook to import into")
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: scrbl-server admin import [-user name] <dir>")
+	}
+	dir := positional[0]
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read import dir: %w", err)
+	}
+
+	s, err := store.New(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	user, err := lookupUser(s, *userName)
+	if err != nil {
+		return err
+	}
+
+	imported := 0
+	unchanged := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		date := strings.TrimSuffix(name, ".md")
+		if entry.IsDir() || date == name {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			fmt.Fprintf(os.Stderr, "skip %s: not a YYYY-MM-DD.md file\n", name)
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+
+		current, err := s.Get(user.ID, date)
+		if err != nil {
+			return err
+		}
+		if current != nil && !current.Deleted && current.Content == string(b) {
+			unchanged++
+			continue
+		}
+
+		if _, _, err := s.Upsert(user.ID, date, string(b), store.AnyRevision); err != nil {
+			return err
+		}
+		imported++
+	}
+
+	fmt.Printf("imported %d notes into %s (%d unchanged)\n", imported, user.Name, unchanged)
+	return nil
+}
+
+func lookupUser(s *store.Store, name string) (*store.User, error) {
+	user, err := s.UserByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("no user named %q (see: admin users list)", name)
+	}
+	return user, nil
+}
+
+// scopesFlag adds -scopes, the comma-separated scopes of a new key.
+func scopesFlag(fs *flag.FlagSet) *string {
+	return fs.String("scopes", strings.Join(store.DefaultScopes, ","), "comma-separated scopes of the key: read, write, admin")
+}
+
+func adminFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	dbPath := fs.String("db", envOr("DB_PATH", "./scrbl.db"), "SQLite database path")
+	return fs, dbPath
+}
+
+// parseInterleaved parses flags that may appear before or after positional
+// arguments and returns the positional ones.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func printAdminUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  scrbl-server admin users add [-scopes list] <name>             Create a user and print its API key")
+	fmt.Fprintln(os.Stderr, "  scrbl-server admin users list                                  List users")
+	fmt.Fprintln(os.Stderr, "  scrbl-server admin keys create [-user name] [-scopes list]     Create an API key")
+	fmt.Fprintln(os.Stderr, "  scrbl-server admin keys list [-user name]                      List API keys")
+	fmt.Fprintln(os.Stderr, "  scrbl-server admin keys scopes <id> <list>                     Change the scopes of an API key")
+	fmt.Fprintln(os.Stderr, "  scrbl-server admin keys revoke <id>                            Revoke an API key")
+	fmt.Fprintln(os.Stderr, "  scrbl-server admin export [-user name] <dir>                   Write notes to <dir>/YYYY-MM-DD.md")
+	fmt.Fprintln(os.Stderr, "  scrbl-server admin import [-user name] <dir>                   Read notes from <dir>/YYYY-MM-DD.md")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Scopes are read (GET requests and the web UI), write (every other request)")
+	fmt.Fprintln(os.Stderr, "and admin (/api/admin, such as backups of every user's notes). New keys get")
+	fmt.Fprintln(os.Stderr, "read,write unless -scopes says otherwise.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Every admin command takes -db (default $DB_PATH or ./scrbl.db) and works")
+	fmt.Fprintln(os.Stderr, "directly on the database, with or without the server running.")
+}
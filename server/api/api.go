@@ -1,27 +1,88 @@
 package api
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
 	"strings"
+	gosync "sync"
+	"time"
 
+	"github.com/juliuswalton/scrbl-server/apiv1"
 	"github.com/juliuswalton/scrbl-server/store"
 )
 
 // Server is the HTTP API server.
 type Server struct {
-	store  *store.Store
-	apiKey string
-	mux    *http.ServeMux
+	store          *store.Store
+	mux            *http.ServeMux
+	metrics        *metrics
+	limiter        *limiter
+	accessLog      *slog.Logger
+	trustedProxies []netip.Prefix
+	apiKey         string
+
+	maxAttachmentSize int64
+
+	closing   chan struct{}
+	closeOnce gosync.Once
+}
+
+// Options configures optional server behaviour. The zero value logs nothing
+// and applies no rate limits or lockouts.
+type Options struct {
+	// AccessLog, when set, receives one line per request.
+	AccessLog *slog.Logger
+
+	// RateLimit is the sustained number of requests per second allowed from
+	// one client IP, with bursts of up to RateBurst. Zero disables it.
+	RateLimit float64
+	RateBurst int
+
+	// LockoutThreshold failed API key checks from one client IP within
+	// LockoutDuration lock it out for LockoutDuration. Zero disables it.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+
+	// TrustedProxies are the addresses allowed to set X-Forwarded-For.
+	TrustedProxies []netip.Prefix
+
+	// MaxAttachmentSize is the largest attachment upload accepted, in bytes.
+	// Zero means DefaultMaxAttachmentSize.
+	MaxAttachmentSize int64
+
+	// APIKey, when set, is accepted as a key of the default user with every
+	// scope. It is only held in memory, so it stops working as soon as the
+	// server is restarted without it.
+	APIKey string
 }
 
-// New creates a new API server.
-func New(s *store.Store, apiKey string) *Server {
+// New creates a new API server. Requests are authenticated against the API
+// keys in the store; while it has none, every request acts as the default
+// user.
+func New(s *store.Store, opts Options) *Server {
 	srv := &Server{
-		store:  s,
-		apiKey: apiKey,
-		mux:    http.NewServeMux(),
+		store:          s,
+		mux:            http.NewServeMux(),
+		metrics:        newMetrics(),
+		limiter:        newLimiter(opts),
+		accessLog:      opts.AccessLog,
+		trustedProxies: opts.TrustedProxies,
+		apiKey:         opts.APIKey,
+		closing:        make(chan struct{}),
+
+		maxAttachmentSize: opts.MaxAttachmentSize,
+	}
+	if srv.maxAttachmentSize <= 0 {
+		srv.maxAttachmentSize = DefaultMaxAttachmentSize
 	}
 	srv.routes()
 	return srv
@@ -29,164 +90,398 @@ func New(s *store.Store, apiKey string) *Server {
 
 // Handler returns the http.Handler for the server.
 func (s *Server) Handler() http.Handler {
-	return s.mux
+	return s.instrument(s.limit(compress(s.mux)))
 }
 
 func (s *Server) routes() {
 	s.mux.HandleFunc("/api/notes", s.auth(s.handleNotesList))
+	s.mux.HandleFunc("/api/notes/batch", s.auth(s.handleNotesBatch))
 	s.mux.HandleFunc("/api/notes/", s.auth(s.handleNotesItem))
+	s.mux.HandleFunc("/api/attachments/", s.auth(s.handleAttachment))
 	s.mux.HandleFunc("/api/search", s.auth(s.handleSearch))
+	s.mux.HandleFunc("/api/events", s.auth(s.handleEvents))
+	s.mux.HandleFunc("/api/shares/", s.auth(s.handleShare))
+	s.mux.HandleFunc("/api/admin/backup", s.auth(s.handleBackup))
+	s.mux.HandleFunc("/api/openapi.json", handleOpenAPI)
 	s.mux.HandleFunc("/health", s.handleHealth)
+	s.mux.HandleFunc("/metrics", s.auth(s.handleMetrics))
+	s.mux.HandleFunc("/s/", s.handleSharePage)
+	s.webRoutes()
 }
 
 // --- Middleware ---
 
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	requestInfoKey
+)
+
+// auth resolves the API key in the Authorization header to a user and stores
+// it in the request context for the handlers. Keys lacking the scope the
+// route needs are refused.
 func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if s.apiKey == "" {
-			next(w, r)
-			return
-		}
-
 		auth := r.Header.Get("Authorization")
-		if auth == "" {
+		token := strings.TrimPrefix(auth, "Bearer ")
+
+		id, scopes, status := s.authenticate(r, token)
+		switch status {
+		case 0:
+			if scope := requiredScope(r); !slices.Contains(scopes, scope) {
+				http.Error(w, scopeError(scope), http.StatusForbidden)
+				return
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), userKey, id)))
+		case http.StatusUnauthorized:
+			s.authFailed(r, "missing api key")
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
+		case http.StatusForbidden:
+			s.authFailed(r, "invalid api key")
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.Error(w, "internal error", status)
 		}
+	}
+}
 
-		token := strings.TrimPrefix(auth, "Bearer ")
-		if token != s.apiKey {
-			http.Error(w, "forbidden", http.StatusForbidden)
-			return
+// authenticate resolves an API key to a user and the scopes it grants. A
+// non-zero status means the request must be rejected: 401 for a missing key,
+// 403 for an unknown one. While the store has no keys every request acts as
+// the default user with every scope.
+func (s *Server) authenticate(r *http.Request, token string) (int64, []string, int) {
+	if token != "" && s.apiKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.apiKey)) == 1 {
+		s.limiter.succeed(infoFrom(r).clientIP)
+		infoFrom(r).userID = store.DefaultUserID
+		return store.DefaultUserID, store.AllScopes, 0
+	}
+	if token != "" {
+		user, scopes, err := s.store.UserForKey(token)
+		if err != nil {
+			log.Printf("ERROR auth: %v", err)
+			return 0, nil, http.StatusInternalServerError
 		}
+		if user != nil {
+			s.limiter.succeed(infoFrom(r).clientIP)
+			infoFrom(r).userID = user.ID
+			return user.ID, scopes, 0
+		}
+	}
 
-		next(w, r)
+	keyed := s.apiKey != ""
+	if !keyed {
+		var err error
+		if keyed, err = s.store.HasAPIKeys(); err != nil {
+			log.Printf("ERROR auth: %v", err)
+			return 0, nil, http.StatusInternalServerError
+		}
+	}
+	if !keyed {
+		infoFrom(r).userID = store.DefaultUserID
+		return store.DefaultUserID, store.AllScopes, 0
+	}
+
+	if token == "" {
+		return 0, nil, http.StatusUnauthorized
+	}
+	return 0, nil, http.StatusForbidden
+}
+
+// requiredScope returns the scope a request needs: admin for /api/admin and
+// /metrics, read to look and write to change anything.
+func requiredScope(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/admin/"), r.URL.Path == "/metrics":
+		return store.ScopeAdmin
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		return store.ScopeRead
+	default:
+		return store.ScopeWrite
 	}
 }
 
+func scopeError(scope string) string {
+	return fmt.Sprintf("forbidden: this api key lacks the %q scope", scope)
+}
+
+// userID returns the user resolved by auth.
+func userID(r *http.Request) int64 {
+	id, _ := r.Context().Value(userKey).(int64)
+	return id
+}
+
 // --- Handlers ---
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	writeJSON(w, apiv1.Health{Status: "ok"})
 }
 
 // GET /api/notes — list all dates
+// GET /api/notes?include=content — list all notes with content
+// GET /api/notes?since=timestamp — notes changed since, including tombstones
+//
+// Each takes optional limit and cursor parameters, which switch the response
+// to a page: {"items": [...], "next_cursor": "..."}.
 func (s *Server) handleNotesList(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	page, paged, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("include") == "content" {
+		notes, next, err := s.store.ListNotesPage(userID(r), page)
+		if errors.Is(err, store.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR list notes: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if paged {
+			writeJSONCached(w, r, newListPage(wireNotes(notes), next))
+			return
+		}
+		writeJSONCached(w, r, wireNotes(notes))
+		return
+	}
+
 	// Check for ?since= param for incremental sync
 	since := r.URL.Query().Get("since")
 	if since != "" {
-		notes, err := s.store.GetUpdatedSince(since)
+		notes, next, err := s.store.GetUpdatedSincePage(userID(r), since, page)
+		if errors.Is(err, store.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			log.Printf("ERROR list updated since: %v", err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
-		writeJSON(w, notes)
+		if paged {
+			writeJSONCached(w, r, newListPage(wireNotes(notes), next))
+			return
+		}
+		writeJSONCached(w, r, wireNotes(notes))
 		return
 	}
 
-	dates, err := s.store.ListDates()
+	dates, next, err := s.store.ListDatesPage(userID(r), page)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Printf("ERROR list dates: %v", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	writeJSON(w, dates)
+	if paged {
+		writeJSONCached(w, r, newListPage(dates, next))
+		return
+	}
+	if dates == nil {
+		dates = []string{}
+	}
+	writeJSONCached(w, r, dates)
 }
 
-// GET/PUT /api/notes/:date
+// GET/PUT/DELETE /api/notes/:date
+// GET /api/notes/:date/revisions[/:revision]
+// POST /api/notes/:date/revisions/:revision/restore
 func (s *Server) handleNotesItem(w http.ResponseWriter, r *http.Request) {
 	// Extract date from path: /api/notes/2025-01-29
-	date := strings.TrimPrefix(r.URL.Path, "/api/notes/")
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/notes/"), "/")
+	date := parts[0]
 	if date == "" || len(date) != 10 {
 		http.Error(w, "invalid date format, expected YYYY-MM-DD", http.StatusBadRequest)
 		return
 	}
 
+	if len(parts) > 1 {
+		switch {
+		case parts[1] == "revisions":
+			s.handleRevisions(w, r, date, parts[2:])
+		case parts[1] == "share" && len(parts) == 2:
+			s.createShare(w, r, date)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		s.getNoteByDate(w, date)
+		s.getNoteByDate(w, r, date)
 	case http.MethodPut:
 		s.putNoteByDate(w, r, date)
+	case http.MethodDelete:
+		s.deleteNoteByDate(w, r, date)
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-func (s *Server) getNoteByDate(w http.ResponseWriter, date string) {
-	note, err := s.store.Get(date)
+func (s *Server) getNoteByDate(w http.ResponseWriter, r *http.Request, date string) {
+	note, err := s.store.Get(userID(r), date)
 	if err != nil {
 		log.Printf("ERROR get note %s: %v", date, err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	if note == nil {
+	if note == nil || note.Deleted {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
-	writeJSON(w, map[string]string{
-		"date":    note.Date,
-		"content": note.Content,
-	})
-}
-
-type putNoteRequest struct {
-	Date    string `json:"date"`
-	Content string `json:"content"`
+	writeJSONCached(w, r, wireNote(note))
 }
 
 func (s *Server) putNoteByDate(w http.ResponseWriter, r *http.Request, date string) {
-	var req putNoteRequest
+	var req apiv1.PutNoteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
+	base := store.AnyRevision
+	if req.BaseRevision != nil {
+		base = *req.BaseRevision
+	}
+
 	// Use the URL date as the source of truth
-	note, err := s.store.Upsert(date, req.Content)
+	note, conflict, err := s.store.Upsert(userID(r), date, req.Content, base)
 	if err != nil {
 		log.Printf("ERROR upsert note %s: %v", date, err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	writeJSON(w, note)
+	if conflict {
+		// Respond with the current server copy so the client can reconcile.
+		writeJSONStatus(w, http.StatusConflict, wireNote(note))
+		return
+	}
+
+	writeJSON(w, wireNote(note))
+}
+
+// DELETE /api/notes/:date[?base_revision=N]
+//
+// The note is replaced by a tombstone, which is returned. base_revision
+// works as in PUT.
+func (s *Server) deleteNoteByDate(w http.ResponseWriter, r *http.Request, date string) {
+	base := store.AnyRevision
+	if raw := r.URL.Query().Get("base_revision"); raw != "" {
+		rev, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || rev < 0 {
+			http.Error(w, "invalid base_revision", http.StatusBadRequest)
+			return
+		}
+		base = rev
+	}
+
+	note, conflict, err := s.store.Delete(userID(r), date, base)
+	if err != nil {
+		log.Printf("ERROR delete note %s: %v", date, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if note == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if conflict {
+		writeJSONStatus(w, http.StatusConflict, wireNote(note))
+		return
+	}
+
+	writeJSON(w, wireNote(note))
 }
 
-// GET /api/search?q=query
+// GET /api/search?q=query[&from=YYYY-MM-DD][&to=YYYY-MM-DD]
+//
+// Without limit or cursor the best 50 results are returned as an array;
+// with them, a page as for GET /api/notes.
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	q := r.URL.Query().Get("q")
-	if q == "" {
+	page, paged, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !paged {
+		page.Limit = store.SearchLimit
+	}
+
+	params := r.URL.Query()
+	q := store.SearchQuery{
+		Text: params.Get("q"),
+		From: params.Get("from"),
+		To:   params.Get("to"),
+	}
+	if q.Text == "" {
 		http.Error(w, "missing query parameter 'q'", http.StatusBadRequest)
 		return
 	}
+	if (q.From != "" && len(q.From) != 10) || (q.To != "" && len(q.To) != 10) {
+		http.Error(w, "invalid date format, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
 
-	results, err := s.store.Search(q)
+	encrypted, err := s.store.HasEncryptedNotes(userID(r))
 	if err != nil {
 		log.Printf("ERROR search: %v", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	if encrypted {
+		http.Error(w, "search is unavailable for encrypted notebooks", http.StatusNotImplemented)
+		return
+	}
 
-	writeJSON(w, results)
+	results, next, err := s.store.SearchPage(userID(r), q, page)
+	if errors.Is(err, store.ErrInvalidQuery) || errors.Is(err, store.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR search: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if paged {
+		writeJSONCached(w, r, newListPage(wireSearchResults(results), next))
+		return
+	}
+	writeJSONCached(w, r, wireSearchResults(results))
 }
 
 func writeJSON(w http.ResponseWriter, v interface{}) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(v); err != nil {
 		log.Printf("ERROR encoding json: %v", err)
 	}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/store"
+)
+
+// DefaultMaxAttachmentSize is the upload limit used when
+// Options.MaxAttachmentSize is zero.
+const DefaultMaxAttachmentSize = 25 << 20
+
+// GET/HEAD/PUT /api/attachments/:hash
+//
+// hash is the hex SHA-256 of the file. PUT takes the raw file as the body,
+// with its type in Content-Type, and answers 201 for a new file or 200 if
+// it was already stored.
+func (s *Server) handleAttachment(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimPrefix(r.URL.Path, "/api/attachments/")
+	if !store.ValidHash(hash) {
+		http.Error(w, "invalid attachment hash, expected hex sha-256", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.getAttachment(w, r, hash)
+	case http.MethodPut:
+		s.putAttachment(w, r, hash)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) putAttachment(w http.ResponseWriter, r *http.Request, hash string) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxAttachmentSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "attachment too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	contentType := "application/octet-stream"
+	if mt, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		contentType = mime.FormatMediaType(mt, params)
+	}
+
+	a, created, err := s.store.PutAttachment(userID(r), hash, contentType, data)
+	if errors.Is(err, store.ErrHashMismatch) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR put attachment %s: %v", hash, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if created {
+		writeJSONStatus(w, http.StatusCreated, wireAttachment(a))
+		return
+	}
+	writeJSON(w, wireAttachment(a))
+}
+
+func (s *Server) getAttachment(w http.ResponseWriter, r *http.Request, hash string) {
+	a, err := s.store.GetAttachment(userID(r), hash)
+	if err != nil {
+		log.Printf("ERROR get attachment %s: %v", hash, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if a == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	serveAttachment(w, r, a)
+}
+
+// serveAttachment writes an attachment's data. Attachments never change, so
+// the hash is a strong ETag and clients may cache them indefinitely. Files
+// are sandboxed, since an uploaded HTML or SVG file is served from the same
+// origin as the web UI.
+func serveAttachment(w http.ResponseWriter, r *http.Request, a *store.Attachment) {
+	h := w.Header()
+	h.Set("Content-Type", a.ContentType)
+	h.Set("ETag", `"`+a.Hash+`"`)
+	h.Set("Cache-Control", "private, max-age=31536000, immutable")
+	h.Set("Content-Security-Policy", "default-src 'none'; img-src 'self' data:; style-src 'unsafe-inline'; sandbox")
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	modified, _ := time.Parse(time.RFC3339, a.CreatedAt)
+	http.ServeContent(w, r, "", modified, bytes.NewReader(a.Data))
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GET /api/admin/backup — a consistent snapshot of the whole database
+//
+// The snapshot holds every user's notes, so it needs a key with the admin
+// scope.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "scrbl-snapshot-*.db")
+	if err != nil {
+		log.Printf("ERROR backup: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := s.store.Backup(tmp.Name()); err != nil {
+		log.Printf("ERROR backup: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		log.Printf("ERROR backup: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("ERROR backup: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Large databases can take longer to send than the write timeout allows.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("ERROR backup: %v", err)
+	}
+
+	name := fmt.Sprintf("scrbl-%s.db", time.Now().UTC().Format("20060102-150405"))
+	h := w.Header()
+	h.Set("Content-Type", "application/vnd.sqlite3")
+	h.Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	h.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	h.Set("Cache-Control", "no-store")
+
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("ERROR backup: sending snapshot: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+	"github.com/juliuswalton/scrbl-server/store"
+)
+
+// maxBatchNotes caps how many notes a single batch request may write.
+const maxBatchNotes = 500
+
+// maxBatchSize caps the body of a batch request, so it is refused before it
+// is read into memory: a full batch at 64 KiB per note on average.
+const maxBatchSize = maxBatchNotes * 64 << 10
+
+// POST /api/notes/batch — upsert many notes in one request
+//
+// Each note is checked and written independently; a conflict or invalid date
+// on one note does not stop the rest. Conflicting results carry the current
+// server copy, as a single PUT would.
+func (s *Server) handleNotesBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req apiv1.BatchRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchSize)).Decode(&req)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "batch too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if len(req.Notes) > maxBatchNotes {
+		http.Error(w, "too many notes in batch", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resp := apiv1.BatchResponse{Results: make([]apiv1.BatchResult, 0, len(req.Notes))}
+	for _, n := range req.Notes {
+		result := apiv1.BatchResult{Date: n.Date}
+
+		if len(n.Date) != 10 {
+			result.Status = apiv1.BatchError
+			result.Error = "invalid date format, expected YYYY-MM-DD"
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+
+		base := store.AnyRevision
+		if n.BaseRevision != nil {
+			base = *n.BaseRevision
+		}
+
+		note, conflict, err := s.store.Upsert(userID(r), n.Date, n.Content, base)
+		switch {
+		case err != nil:
+			log.Printf("ERROR batch upsert note %s: %v", n.Date, err)
+			result.Status = apiv1.BatchError
+			result.Error = "internal error"
+		case conflict:
+			result.Status = apiv1.BatchConflict
+			result.Note = wireNote(note)
+		default:
+			result.Status = apiv1.BatchOK
+			result.Note = wireNote(note)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	writeJSON(w, resp)
+}
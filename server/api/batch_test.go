@@ -0,0 +1,96 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/api"
+	"github.com/juliuswalton/scrbl-server/apiv1"
+	"github.com/juliuswalton/scrbl-server/store"
+)
+
+func postBatch(t *testing.T, h http.Handler, req apiv1.BatchRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/api/notes/batch", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func newBatchServer(t *testing.T) (*store.Store, http.Handler) {
+	t.Helper()
+
+	s, err := store.New(filepath.Join(t.TempDir(), "scrbl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	srv := api.New(s, api.Options{})
+	t.Cleanup(srv.CloseStreams)
+	return s, srv.Handler()
+}
+
+// TestBatchNoteLimit checks that a batch of 500 notes is written and one of
+// 501 is refused without writing any.
+func TestBatchNoteLimit(t *testing.T) {
+	s, h := newBatchServer(t)
+
+	batch := func(n int) apiv1.BatchRequest {
+		var req apiv1.BatchRequest
+		day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := range n {
+			req.Notes = append(req.Notes, apiv1.PutNoteRequest{Date: day.AddDate(0, 0, i).Format("2006-01-02"), Content: fmt.Sprintf("note %d\n", i)})
+		}
+		return req
+	}
+
+	if rec := postBatch(t, h, batch(501)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST of 501 notes = %d, want 413", rec.Code)
+	}
+	if dates, err := s.ListDates(store.DefaultUserID); err != nil || len(dates) != 0 {
+		t.Errorf("after a refused batch, ListDates = %d dates, %v; want none", len(dates), err)
+	}
+
+	rec := postBatch(t, h, batch(500))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST of 500 notes = %d %s, want 200", rec.Code, rec.Body)
+	}
+	var resp apiv1.BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 500 {
+		t.Errorf("got %d results, want 500", len(resp.Results))
+	}
+	for _, r := range resp.Results {
+		if r.Status != apiv1.BatchOK {
+			t.Errorf("%s: %s %s", r.Date, r.Status, r.Error)
+		}
+	}
+}
+
+// TestBatchTooLarge checks that an oversized batch is refused while it is
+// read, not after it has been decoded.
+func TestBatchTooLarge(t *testing.T) {
+	_, h := newBatchServer(t)
+
+	content := strings.Repeat("x", 40<<20)
+	rec := postBatch(t, h, apiv1.BatchRequest{Notes: []apiv1.PutNoteRequest{{Date: "2026-02-17", Content: content}}})
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST of a 40 MiB batch = %d, want 413", rec.Code)
+	}
+}
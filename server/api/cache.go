@@ -0,0 +1,60 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// writeJSONCached writes v like writeJSON, with an ETag derived from the
+// encoded body. A request whose If-None-Match lists that ETag gets 304 Not
+// Modified and no body.
+//
+// ETags are weak because the body may be sent gzip-encoded; weak comparison
+// is what If-None-Match uses anyway.
+func writeJSONCached(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("ERROR encoding json: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+
+	sum := sha256.Sum256(body)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	// Responses depend on the API key, so only the client may cache them,
+	// and it must revalidate every time.
+	h.Set("Cache-Control", "private, no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using weak
+// comparison.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,455 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/api"
+	"github.com/juliuswalton/scrbl-server/apiv1"
+	"github.com/juliuswalton/scrbl-server/apiv1/apitest"
+	"github.com/juliuswalton/scrbl-server/store"
+)
+
+// contractClient sends requests to a server wrapped in an apitest.Checker.
+type contractClient struct {
+	t   *testing.T
+	url string
+	key string
+}
+
+func (c *contractClient) do(method, path string, body []byte, header http.Header) (*http.Response, []byte) {
+	c.t.Helper()
+
+	req, err := http.NewRequest(method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.key != "" {
+		req.Header.Set("Authorization", "Bearer "+c.key)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp, data
+}
+
+// expect sends a request and fails unless it gets the wanted status.
+func (c *contractClient) expect(status int, method, path string, body any, header http.Header) (*http.Response, []byte) {
+	c.t.Helper()
+
+	var raw []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		raw = b
+	default:
+		var err error
+		if raw, err = json.Marshal(b); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+
+	resp, data := c.do(method, path, raw, header)
+	if resp.StatusCode != status {
+		c.t.Fatalf("%s %s = %d %s, want %d", method, path, resp.StatusCode, data, status)
+	}
+	return resp, data
+}
+
+func decode[T any](t *testing.T, data []byte) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return v
+}
+
+func rev(n int64) *int64 { return &n }
+
+// TestContract exercises every operation in the OpenAPI document against a
+// real server and store, checking each request and response against it.
+func TestContract(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "scrbl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	srv := api.New(s, api.Options{})
+	checker := apitest.Default().Check(t, srv.Handler())
+	ts := httptest.NewServer(checker)
+	defer ts.Close()
+	defer srv.CloseStreams()
+
+	c := &contractClient{t: t, url: ts.URL}
+	none := http.Header{}
+
+	c.expect(200, "GET", "/health", nil, none)
+	c.expect(200, "GET", "/metrics", nil, none)
+	if _, data := c.expect(200, "GET", "/api/openapi.json", nil, none); !bytes.Equal(data, apiv1.OpenAPI) {
+		t.Error("GET /api/openapi.json does not serve apiv1.OpenAPI")
+	}
+
+	// Empty listings are arrays, not null.
+	if _, data := c.expect(200, "GET", "/api/notes", nil, none); strings.TrimSpace(string(data)) != "[]" {
+		t.Errorf("GET /api/notes on an empty store = %s, want []", data)
+	}
+
+	// Notes.
+	_, data := c.expect(200, "PUT", "/api/notes/2026-02-17", apiv1.PutNoteRequest{Date: "2026-02-17", Content: "hello world", BaseRevision: rev(0)}, none)
+	saved := decode[apiv1.Note](t, data)
+	if saved.Revision != 1 {
+		t.Errorf("first revision = %d, want 1", saved.Revision)
+	}
+	c.expect(409, "PUT", "/api/notes/2026-02-17", apiv1.PutNoteRequest{Date: "2026-02-17", Content: "stale", BaseRevision: rev(0)}, none)
+	c.expect(200, "PUT", "/api/notes/2026-02-17", apiv1.PutNoteRequest{Date: "2026-02-17", Content: "hello again world"}, none)
+
+	resp, _ := c.expect(200, "GET", "/api/notes/2026-02-17", nil, none)
+	c.expect(304, "GET", "/api/notes/2026-02-17", nil, http.Header{"If-None-Match": {resp.Header.Get("ETag")}})
+	c.expect(404, "GET", "/api/notes/2026-01-01", nil, none)
+
+	_, data = c.expect(200, "POST", "/api/notes/batch", apiv1.BatchRequest{Notes: []apiv1.PutNoteRequest{
+		{Date: "2026-02-18", Content: "batched", BaseRevision: rev(0)},
+		{Date: "2026-02-17", Content: "conflicting", BaseRevision: rev(1)},
+	}}, none)
+	batch := decode[apiv1.BatchResponse](t, data)
+	var statuses []string
+	for _, r := range batch.Results {
+		statuses = append(statuses, r.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "ok,conflict" {
+		t.Errorf("batch statuses = %s, want ok,conflict", got)
+	}
+
+	c.expect(200, "GET", "/api/notes?include=content", nil, none)
+	c.expect(200, "GET", "/api/notes?since=1970-01-01T00:00:00Z", nil, none)
+	_, data = c.expect(200, "GET", "/api/notes?limit=1", nil, none)
+	page := decode[apiv1.Page[string]](t, data)
+	if page.NextCursor == "" {
+		t.Fatal("first page of two has no next_cursor")
+	}
+	c.expect(200, "GET", "/api/notes?cursor="+page.NextCursor, nil, none)
+	c.expect(200, "GET", "/api/notes?include=content&limit=1", nil, none)
+	c.expect(200, "GET", "/api/notes?since=1970-01-01T00:00:00Z&limit=1", nil, none)
+	c.expect(400, "GET", "/api/notes?cursor=bogus", nil, none)
+
+	// History.
+	c.expect(200, "GET", "/api/notes/2026-02-17/revisions", nil, none)
+	c.expect(200, "GET", "/api/notes/2026-02-17/revisions/1", nil, none)
+	c.expect(404, "GET", "/api/notes/2026-02-17/revisions/99", nil, none)
+	c.expect(200, "POST", "/api/notes/2026-02-17/revisions/1/restore", nil, none)
+
+	// Search.
+	c.expect(200, "GET", "/api/search?q=hello", nil, none)
+	c.expect(200, "GET", "/api/search?q=hello&from=2026-01-01&to=2026-12-31&limit=1", nil, none)
+	c.expect(400, "GET", "/api/search?q=%22", nil, none)
+
+	// Deletes.
+	c.expect(409, "DELETE", "/api/notes/2026-02-18?base_revision=5", nil, none)
+	c.expect(200, "DELETE", "/api/notes/2026-02-18", nil, none)
+	c.expect(404, "DELETE", "/api/notes/2026-01-01", nil, none)
+
+	// Attachments.
+	file := []byte("\x89PNG\r\n\x1a\nnot really an image")
+	sum := sha256.Sum256(file)
+	hash := hex.EncodeToString(sum[:])
+	png := http.Header{"Content-Type": {"image/png"}}
+	c.expect(404, "HEAD", "/api/attachments/"+hash, nil, none)
+	c.expect(201, "PUT", "/api/attachments/"+hash, file, png)
+	c.expect(200, "PUT", "/api/attachments/"+hash, file, png)
+	c.expect(400, "PUT", "/api/attachments/"+strings.Repeat("0", 64), file, png)
+	c.expect(200, "HEAD", "/api/attachments/"+hash, nil, none)
+	resp, _ = c.expect(200, "GET", "/api/attachments/"+hash, nil, none)
+	c.expect(304, "GET", "/api/attachments/"+hash, nil, http.Header{"If-None-Match": {resp.Header.Get("ETag")}})
+	c.expect(206, "GET", "/api/attachments/"+hash, nil, http.Header{"Range": {"bytes=0-3"}})
+	c.expect(404, "GET", "/api/attachments/"+strings.Repeat("0", 64), nil, none)
+
+	// Shares.
+	c.expect(200, "PUT", "/api/notes/2026-02-20", apiv1.PutNoteRequest{Date: "2026-02-20", Content: "for the manager\n\n![chart](assets/" + hash + ".png)"}, none)
+	_, data = c.expect(201, "POST", "/api/notes/2026-02-20/share", apiv1.ShareRequest{ExpiresAt: time.Now().Add(time.Hour).UTC().Format(time.RFC3339)}, none)
+	share := decode[apiv1.Share](t, data)
+	c.expect(201, "POST", "/api/notes/2026-02-20/share", nil, none)
+	c.expect(400, "POST", "/api/notes/2026-02-20/share", apiv1.ShareRequest{ExpiresAt: "2020-01-01T00:00:00Z"}, none)
+	c.expect(404, "POST", "/api/notes/2026-01-01/share", nil, none)
+	if _, data := c.expect(200, "GET", share.Path, nil, none); !strings.Contains(string(data), "for the manager") {
+		t.Errorf("GET %s does not show the note: %s", share.Path, data)
+	}
+	c.expect(200, "GET", share.Path+"/assets/"+hash+".png", nil, none)
+	c.expect(404, "GET", share.Path+"/assets/"+strings.Repeat("0", 64)+".png", nil, none)
+	c.expect(204, "DELETE", "/api/shares/"+share.Token, nil, none)
+	c.expect(404, "DELETE", "/api/shares/"+share.Token, nil, none)
+	c.expect(404, "GET", share.Path, nil, none)
+
+	// Events.
+	checkEvents(t, c)
+
+	c.expect(200, "GET", "/api/admin/backup", nil, none)
+
+	// Once keys exist, requests must carry one.
+	ownerKey, err := s.CreateAPIKey(store.DefaultUserID, store.AllScopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readKey, err := s.CreateAPIKey(store.DefaultUserID, []string{store.ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.CreateUser("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobKey, err := s.CreateAPIKey(bob.ID, store.DefaultScopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.expect(401, "GET", "/api/notes", nil, none)
+	c.key = "scrbl_not-a-key"
+	c.expect(403, "GET", "/api/notes", nil, none)
+	c.key = ownerKey
+	c.expect(200, "GET", "/api/notes", nil, none)
+	c.expect(200, "GET", "/api/admin/backup", nil, none)
+
+	c.key = readKey
+	c.expect(200, "GET", "/api/notes/2026-02-17", nil, none)
+	if _, data := c.expect(403, "PUT", "/api/notes/2026-02-17", apiv1.PutNoteRequest{Date: "2026-02-17", Content: "read only"}, none); !strings.Contains(string(data), `"write" scope`) {
+		t.Errorf("PUT with a read-only key = %s, want a scope error", data)
+	}
+
+	c.key = bobKey
+	c.expect(403, "GET", "/api/admin/backup", nil, none)
+	c.expect(404, "GET", "/api/notes/2026-02-17", nil, none)
+	c.expect(200, "PUT", "/api/notes/2026-03-01", apiv1.PutNoteRequest{Date: "2026-03-01", Content: apiv1.EncryptedPrefix + "c2VhbGVk"}, none)
+	c.expect(501, "GET", "/api/search?q=sealed", nil, none)
+	c.expect(501, "POST", "/api/notes/2026-03-01/share", nil, none)
+
+	srv.CloseStreams()
+	ts.Close()
+	if missing := checker.Uncovered(); len(missing) > 0 {
+		t.Errorf("operations not exercised: %v", missing)
+	}
+}
+
+// checkEvents subscribes to the change feed, writes a note and checks the
+// note event that follows.
+func checkEvents(t *testing.T, c *contractClient) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url+"/api/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	spec := apitest.Default()
+	lines := bufio.NewScanner(resp.Body)
+	wrote := false
+	event := ""
+	for lines.Scan() {
+		field, value, _ := strings.Cut(lines.Text(), ": ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			switch event {
+			case apiv1.EventReady:
+				if !wrote {
+					c.expect(200, "PUT", "/api/notes/2026-02-19", apiv1.PutNoteRequest{Date: "2026-02-19", Content: "live"}, http.Header{})
+					wrote = true
+				}
+			case apiv1.EventNote:
+				var change apiv1.NoteChange
+				if err := json.Unmarshal([]byte(value), &change); err != nil {
+					t.Fatalf("decode note event %s: %v", value, err)
+				}
+				if err := spec.CheckValue("NoteChange", change); err != nil {
+					t.Error(err)
+				}
+				if change.Date != "2026-02-19" {
+					t.Errorf("note event for %s, want 2026-02-19", change.Date)
+				}
+				return
+			}
+		}
+	}
+	t.Fatalf("event stream ended without a note event: %v", lines.Err())
+}
+
+// TestScopes checks that the server asks for the scopes the OpenAPI document
+// declares: a key with every other scope is refused each operation.
+func TestScopes(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "scrbl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	srv := api.New(s, api.Options{})
+	defer srv.CloseStreams()
+	h := srv.Handler()
+
+	keys := map[string]string{}
+	for _, scope := range store.AllScopes {
+		var others []string
+		for _, other := range store.AllScopes {
+			if other != scope {
+				others = append(others, other)
+			}
+		}
+		key, err := s.CreateAPIKey(store.DefaultUserID, others)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[scope] = key
+	}
+
+	example := strings.NewReplacer("{date}", "2026-02-17", "{revision}", "1", "{hash}", strings.Repeat("0", 64), "{token}", strings.Repeat("0", 32))
+	for _, op := range apitest.Default().Operations() {
+		if len(op.Scopes) != 1 {
+			if op.Scopes != nil {
+				t.Errorf("%s: scopes %v, want exactly one", op.ID, op.Scopes)
+			}
+			continue
+		}
+		req := httptest.NewRequest(op.Method, example.Replace(op.Path), nil)
+		req.Header.Set("Authorization", "Bearer "+keys[op.Scopes[0]])
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s without the %s scope = %d, want 403", op.ID, op.Scopes[0], rec.Code)
+		}
+	}
+}
+
+// TestAPIKeyOption checks that Options.APIKey authenticates as the default
+// user without being stored, so restarting without it cuts it off.
+func TestAPIKeyOption(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "scrbl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	srv := api.New(s, api.Options{APIKey: "operator-key-0123456789"})
+	defer srv.CloseStreams()
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	c := &contractClient{t: t, url: ts.URL}
+	none := http.Header{}
+	c.expect(401, "GET", "/api/notes", nil, none)
+	c.key = "operator-key-wrong"
+	c.expect(403, "GET", "/api/notes", nil, none)
+	c.key = "operator-key-0123456789"
+	c.expect(200, "GET", "/api/notes", nil, none)
+	c.expect(200, "GET", "/api/admin/backup", nil, none)
+
+	if keyed, err := s.HasAPIKeys(); err != nil || keyed {
+		t.Errorf("HasAPIKeys = %v, %v; the key must not be stored", keyed, err)
+	}
+}
+
+// TestWebSession checks that the web UI cookie is an opaque session that
+// ends with its key, and is Secure behind a trusted HTTPS proxy.
+func TestWebSession(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "scrbl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	key, err := s.CreateAPIKey(store.DefaultUserID, store.DefaultScopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := api.New(s, api.Options{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}})
+	defer srv.CloseStreams()
+	h := srv.Handler()
+
+	login := func(proto string) *http.Cookie {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/ui/login", strings.NewReader(url.Values{"key": {key}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-Proto", proto)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("login = %d %s, want 303", rec.Code, rec.Body)
+		}
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "scrbl_session" {
+				return c
+			}
+		}
+		t.Fatal("login set no session cookie")
+		return nil
+	}
+	days := func(c *http.Cookie) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/ui/", nil)
+		req.AddCookie(c)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if c := login("http"); c.Secure {
+		t.Error("cookie is Secure over plain HTTP")
+	}
+	c := login("https")
+	if !c.Secure {
+		t.Error("cookie is not Secure behind a trusted HTTPS proxy")
+	}
+	if strings.Contains(c.Value, key) {
+		t.Error("cookie holds the API key")
+	}
+	if got := days(c); got != http.StatusOK {
+		t.Errorf("GET /ui/ with a session = %d, want 200", got)
+	}
+
+	keys, err := s.ListAPIKeys(store.DefaultUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeAPIKey(keys[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := days(c); got != http.StatusFound {
+		t.Errorf("GET /ui/ after revoking the key = %d, want 302", got)
+	}
+}
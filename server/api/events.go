@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// eventsHeartbeat is how often an idle event stream sends a comment, so
+// proxies and clients can tell it is alive.
+const eventsHeartbeat = 25 * time.Second
+
+// GET /api/events — server-sent events stream of note changes
+//
+// A "ready" event is sent once the subscription is active, then a "note"
+// event with the date, revision, updated_at and deleted flag of every write
+// to the user's notes. Content is not included; clients pull changed days.
+// Events have no id and a reconnect does not replay missed ones, so clients
+// catch up with ?since= instead.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout by design.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("ERROR events: %v", err)
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	changes, unsubscribe := s.store.Subscribe(userID(r))
+	defer unsubscribe()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: 5000\nevent: %s\ndata: {}\n\n", apiv1.EventReady)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case c := <-changes:
+			data, err := json.Marshal(wireChange(c))
+			if err != nil {
+				log.Printf("ERROR encoding event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", apiv1.EventNote, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// CloseStreams ends every open event stream. Call it when shutting down, as
+// http.Server.Shutdown does not interrupt active requests.
+func (s *Server) CloseStreams() {
+	s.closeOnce.Do(func() { close(s.closing) })
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	gosync "sync"
+)
+
+var gzipWriters = gosync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// gzipResponseWriter compresses the body once the handler has committed to a
+// compressible response.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.decide(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide picks the encoding from the status and headers set so far.
+// Bodiless responses, byte ranges, streams and already-encoded or compressed
+// bodies are passed through.
+func (w *gzipResponseWriter) decide(status int) {
+	w.decided = true
+
+	h := w.Header()
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		return
+	}
+	if h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+		return
+	}
+
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+// Flush flushes compressed data written so far to the client.
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	gzipWriters.Put(w.gz)
+	w.gz = nil
+}
+
+// compress gzips responses for clients that accept it.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// compressible reports whether a body of the given type is worth gzipping.
+// Event streams must reach the client unbuffered, and most media types are
+// compressed already.
+func compressible(contentType string) bool {
+	switch {
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		return false
+	case strings.HasPrefix(contentType, "image/svg+xml"):
+		return true
+	case strings.HasPrefix(contentType, "image/"), strings.HasPrefix(contentType, "audio/"),
+		strings.HasPrefix(contentType, "video/"), strings.HasPrefix(contentType, "application/zip"),
+		strings.HasPrefix(contentType, "application/gzip"):
+		return false
+	}
+	return true
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		// gzip;q=0 means the client refuses it.
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				q, err := strconv.ParseFloat(v, 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+// limiterSweepInterval is how often idle client entries are dropped.
+const limiterSweepInterval = 5 * time.Minute
+
+// clientState is the rate-limit and lockout state of one client IP.
+type clientState struct {
+	tokens      float64
+	last        time.Time
+	failures    int
+	firstFail   time.Time
+	lockedUntil time.Time
+}
+
+// limiter applies a token bucket per client IP and locks out clients after
+// repeated authentication failures.
+type limiter struct {
+	mu        gosync.Mutex
+	clients   map[string]*clientState
+	lastSweep time.Time
+
+	rate      float64
+	burst     float64
+	threshold int
+	lockout   time.Duration
+}
+
+func newLimiter(opts Options) *limiter {
+	return &limiter{
+		clients:   map[string]*clientState{},
+		lastSweep: time.Now(),
+		rate:      opts.RateLimit,
+		burst:     float64(max(opts.RateBurst, 1)),
+		threshold: opts.LockoutThreshold,
+		lockout:   opts.LockoutDuration,
+	}
+}
+
+// allow takes a token for ip. When the request must be rejected it returns
+// false and how long the client should wait.
+func (l *limiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweepLocked(now)
+	c := l.clientLocked(ip, now)
+
+	if now.Before(c.lockedUntil) {
+		return false, c.lockedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	c.tokens = math.Min(l.burst, c.tokens+now.Sub(c.last).Seconds()*l.rate)
+	c.last = now
+	if c.tokens < 1 {
+		return false, time.Duration((1 - c.tokens) / l.rate * float64(time.Second))
+	}
+	c.tokens--
+	return true, 0
+}
+
+// fail records a failed authentication and reports whether ip is now locked
+// out, along with its failure count. Failures older than the lockout
+// duration are forgotten.
+func (l *limiter) fail(ip string, now time.Time) (locked bool, failures int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.clientLocked(ip, now)
+	if l.threshold <= 0 {
+		return false, 0
+	}
+
+	if now.Sub(c.firstFail) > l.lockout {
+		c.failures = 0
+		c.firstFail = now
+	}
+	c.failures++
+	if c.failures >= l.threshold {
+		c.lockedUntil = now.Add(l.lockout)
+		c.failures = 0
+		return true, l.threshold
+	}
+	return false, c.failures
+}
+
+// succeed clears the failure count of ip after a successful authentication.
+func (l *limiter) succeed(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c, ok := l.clients[ip]; ok {
+		c.failures = 0
+	}
+}
+
+func (l *limiter) clientLocked(ip string, now time.Time) *clientState {
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &clientState{tokens: l.burst, last: now}
+		l.clients[ip] = c
+	}
+	return c
+}
+
+// sweepLocked drops clients that are neither locked out nor recently seen,
+// so the map does not grow with every address that ever connected.
+func (l *limiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < limiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for ip, c := range l.clients {
+		idle := now.Sub(c.last) > limiterSweepInterval && now.Sub(c.firstFail) > l.lockout
+		if idle && now.After(c.lockedUntil) {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// limit rejects requests from clients that are over their rate limit or
+// locked out. /health is exempt so probes keep working.
+func (s *Server) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := s.clientIP(r)
+		infoFrom(r).clientIP = ip
+
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ok, wait := s.limiter.allow(ip, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authFailed records a rejected API key from the request's client.
+func (s *Server) authFailed(r *http.Request, reason string) {
+	info := infoFrom(r)
+	info.authFailed = true
+
+	locked, failures := s.limiter.fail(info.clientIP, time.Now())
+	if s.limiter.threshold <= 0 {
+		log.Printf("WARNING auth failed from %s: %s", info.clientIP, reason)
+		return
+	}
+	log.Printf("WARNING auth failed from %s: %s (%d/%d)", info.clientIP, reason, failures, s.limiter.threshold)
+	if locked {
+		log.Printf("WARNING locking out %s for %s after %d failed attempts", info.clientIP, s.limiter.lockout, failures)
+	}
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only
+// honoured when the connection comes from a trusted proxy; the client is then
+// the rightmost forwarded address that is not itself a trusted proxy.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !s.trustedProxy(host) {
+		return host
+	}
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !s.trustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func (s *Server) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range s.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request duration
+// histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	route  string
+	method string
+	status int
+}
+
+type latencyKey struct {
+	route  string
+	status int
+}
+
+type histogram struct {
+	buckets []uint64 // cumulative counts are computed when written
+	sum     float64
+	count   uint64
+}
+
+// metrics holds request counters and latency histograms in memory and
+// renders them in the Prometheus text exposition format.
+type metrics struct {
+	mu           gosync.Mutex
+	requests     map[requestKey]uint64
+	latency      map[latencyKey]*histogram
+	authFailures uint64
+	rateLimits   uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: map[requestKey]uint64{},
+		latency:  map[latencyKey]*histogram{},
+	}
+}
+
+func (m *metrics) observe(route, method string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{route, method, status}]++
+
+	key := latencyKey{route, status}
+	h := m.latency[key]
+	if h == nil {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.latency[key] = h
+	}
+	seconds := elapsed.Seconds()
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (m *metrics) authFailure() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.authFailures++
+}
+
+func (m *metrics) rateLimited() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rateLimits++
+}
+
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP scrbl_http_requests_total HTTP requests by route, method and status.")
+	fmt.Fprintln(w, "# TYPE scrbl_http_requests_total counter")
+	reqKeys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		reqKeys = append(reqKeys, k)
+	}
+	sort.Slice(reqKeys, func(i, j int) bool {
+		a, b := reqKeys[i], reqKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	for _, k := range reqKeys {
+		fmt.Fprintf(w, "scrbl_http_requests_total{route=%q,method=%q,status=\"%d\"} %d\n", k.route, k.method, k.status, m.requests[k])
+	}
+
+	fmt.Fprintln(w, "# HELP scrbl_http_request_duration_seconds HTTP request latency by route and status.")
+	fmt.Fprintln(w, "# TYPE scrbl_http_request_duration_seconds histogram")
+	latKeys := make([]latencyKey, 0, len(m.latency))
+	for k := range m.latency {
+		latKeys = append(latKeys, k)
+	}
+	sort.Slice(latKeys, func(i, j int) bool {
+		a, b := latKeys[i], latKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		return a.status < b.status
+	})
+	for _, k := range latKeys {
+		h := m.latency[k]
+		labels := fmt.Sprintf("route=%q,status=\"%d\"", k.route, k.status)
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += h.buckets[i]
+			fmt.Fprintf(w, "scrbl_http_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "scrbl_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "scrbl_http_request_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(w, "scrbl_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP scrbl_auth_failures_total Requests rejected with 401 or 403 by auth.")
+	fmt.Fprintln(w, "# TYPE scrbl_auth_failures_total counter")
+	fmt.Fprintf(w, "scrbl_auth_failures_total %d\n", m.authFailures)
+
+	fmt.Fprintln(w, "# HELP scrbl_rate_limited_total Requests rejected by rate limiting or lockout.")
+	fmt.Fprintln(w, "# TYPE scrbl_rate_limited_total counter")
+	fmt.Fprintf(w, "scrbl_rate_limited_total %d\n", m.rateLimits)
+}
+
+// routeLabel maps a request path to its route pattern, so per-date paths do
+// not create a metric series each.
+func routeLabel(path string) string {
+	switch path {
+	case "/api/notes", "/api/notes/batch", "/api/search", "/api/events", "/api/admin/backup",
+		"/api/openapi.json", "/health", "/metrics":
+		return path
+	}
+
+	switch {
+	case path == "/", path == "/ui/", path == "/ui/search", path == "/ui/login", path == "/ui/logout":
+		return path
+	case strings.HasPrefix(path, "/api/attachments/"):
+		return "/api/attachments/:hash"
+	case strings.HasPrefix(path, "/ui/day/assets/"):
+		return "/ui/day/assets/:file"
+	case strings.HasPrefix(path, "/ui/day/"):
+		return "/ui/day/:date"
+	case strings.HasPrefix(path, "/ui/static/"):
+		return "/ui/static/*"
+	case strings.HasPrefix(path, "/api/shares/"):
+		return "/api/shares/:token"
+	case strings.HasPrefix(path, "/s/"):
+		if _, rest, _ := strings.Cut(strings.TrimPrefix(path, "/s/"), "/"); strings.HasPrefix(rest, "assets/") {
+			return "/s/:token/assets/:file"
+		}
+		return "/s/:token"
+	}
+
+	rest, ok := strings.CutPrefix(path, "/api/notes/")
+	if !ok {
+		return "other"
+	}
+	parts := strings.Split(rest, "/")
+	switch {
+	case len(parts) == 1:
+		return "/api/notes/:date"
+	case len(parts) == 2 && parts[1] == "share":
+		return "/api/notes/:date/share"
+	case parts[1] != "revisions":
+		return "other"
+	case len(parts) == 2 || (len(parts) == 3 && parts[2] == ""):
+		return "/api/notes/:date/revisions"
+	case len(parts) == 3:
+		return "/api/notes/:date/revisions/:revision"
+	case len(parts) == 4 && parts[3] == "restore":
+		return "/api/notes/:date/revisions/:revision/restore"
+	default:
+		return "other"
+	}
+}
+
+// GET /metrics — Prometheus text format, for admin keys only
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := s.store.Stats()
+	if err != nil {
+		log.Printf("ERROR metrics: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w)
+
+	gauges := []struct {
+		name, help string
+		value      int64
+	}{
+		{"scrbl_users", "Registered users.", stats.Users},
+		{"scrbl_notes", "Stored notes, excluding deleted days.", stats.Notes},
+		{"scrbl_note_tombstones", "Deleted days kept as tombstones.", stats.Tombstones},
+		{"scrbl_note_revisions", "Stored note revisions.", stats.Revisions},
+		{"scrbl_attachments", "Stored attachments.", stats.Attachments},
+		{"scrbl_attachment_bytes", "Total size of stored attachments.", stats.AttachmentBytes},
+		{"scrbl_db_size_bytes", "Size of the main SQLite database file.", stats.DBSizeBytes},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, g.value)
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestInfo is filled in by handlers deeper in the chain for the access
+// log, which only sees the request before auth replaces its context.
+type requestInfo struct {
+	clientIP   string
+	userID     int64
+	authFailed bool
+}
+
+func infoFrom(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoKey).(*requestInfo)
+	if info == nil {
+		return &requestInfo{}
+	}
+	return info
+}
+
+// statusRecorder captures the status code and body size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// instrument records metrics for every request and, when accessLog is set,
+// writes one access-log line per request.
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{}
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey, info)))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		elapsed := time.Since(start)
+		route := routeLabel(r.URL.Path)
+
+		s.metrics.observe(route, r.Method, rec.status, elapsed)
+		if info.authFailed {
+			s.metrics.authFailure()
+		}
+		if rec.status == http.StatusTooManyRequests {
+			s.metrics.rateLimited()
+		}
+
+		if s.accessLog == nil {
+			return
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", logPath(r.URL.Path, route)),
+			slog.String("route", route),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+			slog.String("remote", info.clientIP),
+		}
+		if info.userID != 0 {
+			attrs = append(attrs, slog.Int64("user_id", info.userID))
+		}
+		if info.authFailed {
+			attrs = append(attrs, slog.Bool("auth_failed", true))
+		}
+		s.accessLog.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+	})
+}
+
+// logPath is the path written to the access log. Share tokens grant access
+// on their own, so like API keys they are kept out of it.
+func logPath(path, route string) string {
+	if strings.Contains(route, ":token") {
+		return route
+	}
+	return path
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+	"github.com/juliuswalton/scrbl-server/store"
+)
+
+// defaultPageLimit applies when a request has a cursor but no limit.
+const defaultPageLimit = 100
+
+func newListPage[T any](items []T, next string) apiv1.Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return apiv1.Page[T]{Items: items, NextCursor: next}
+}
+
+// pageParams reads ?limit= and ?cursor=. paged is false when neither is set;
+// such requests get the whole listing as a bare array, as they did before
+// pagination existed.
+func pageParams(r *http.Request) (p store.Page, paged bool, err error) {
+	params := r.URL.Query()
+	p.Cursor = params.Get("cursor")
+
+	raw := params.Get("limit")
+	if raw == "" && p.Cursor == "" {
+		return p, false, nil
+	}
+
+	p.Limit = defaultPageLimit
+	if raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return p, true, errors.New("invalid limit")
+		}
+		p.Limit = min(n, store.MaxPageLimit)
+	}
+	return p, true, nil
+}
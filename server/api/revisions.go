@@ -0,0 +1,80 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// handleRevisions serves the history of a single day. rest is the path after
+// /api/notes/:date/revisions.
+func (s *Server) handleRevisions(w http.ResponseWriter, r *http.Request, date string, rest []string) {
+	if len(rest) == 0 || (len(rest) == 1 && rest[0] == "") {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.listRevisions(w, r, date)
+		return
+	}
+
+	revision, err := strconv.ParseInt(rest[0], 10, 64)
+	if err != nil || revision < 1 {
+		http.Error(w, "invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(rest) == 1 && r.Method == http.MethodGet:
+		s.getRevision(w, r, date, revision)
+	case len(rest) == 2 && rest[1] == "restore" && r.Method == http.MethodPost:
+		s.restoreRevision(w, r, date, revision)
+	case len(rest) <= 2:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (s *Server) listRevisions(w http.ResponseWriter, r *http.Request, date string) {
+	revs, err := s.store.ListRevisions(userID(r), date)
+	if err != nil {
+		log.Printf("ERROR list revisions %s: %v", date, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, wireRevisions(revs))
+}
+
+func (s *Server) getRevision(w http.ResponseWriter, r *http.Request, date string, revision int64) {
+	rev, err := s.store.GetRevision(userID(r), date, revision)
+	if err != nil {
+		log.Printf("ERROR get revision %s/%d: %v", date, revision, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if rev == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, wireRevision(rev))
+}
+
+func (s *Server) restoreRevision(w http.ResponseWriter, r *http.Request, date string, revision int64) {
+	note, err := s.store.Restore(userID(r), date, revision)
+	if err != nil {
+		log.Printf("ERROR restore %s/%d: %v", date, revision, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if note == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, wireNote(note))
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+	"github.com/juliuswalton/scrbl-server/store"
+)
+
+// POST /api/notes/:date/share
+//
+// Creates a public link to the note, answering 201 with its token. The
+// optional body sets expires_at. Encrypted notes cannot be shared, as the
+// server cannot render them.
+func (s *Server) createShare(w http.ResponseWriter, r *http.Request, date string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req apiv1.ShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	var expires time.Time
+	if req.ExpiresAt != "" {
+		var err error
+		if expires, err = time.Parse(time.RFC3339, req.ExpiresAt); err != nil {
+			http.Error(w, "invalid expires_at, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		if !expires.After(time.Now()) {
+			http.Error(w, "expires_at is in the past", http.StatusBadRequest)
+			return
+		}
+	}
+
+	note, err := s.store.Get(userID(r), date)
+	if err != nil {
+		log.Printf("ERROR get note %s: %v", date, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if note == nil || note.Deleted {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if strings.HasPrefix(note.Content, store.EncryptedPrefix) {
+		http.Error(w, "encrypted notes cannot be shared", http.StatusNotImplemented)
+		return
+	}
+
+	token, sh, err := s.store.CreateShare(userID(r), date, expires)
+	if err != nil {
+		log.Printf("ERROR create share %s: %v", date, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONStatus(w, http.StatusCreated, wireShare(token, sh))
+}
+
+// DELETE /api/shares/:token
+//
+// Revokes a link, answering 204. Only the user who created it may.
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/api/shares/")
+	err := s.store.RevokeShare(userID(r), token)
+	if errors.Is(err, store.ErrShareNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR revoke share: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /s/:token — a shared day, without an API key
+//
+// The page sets its base to /s/:token/, so attachments the note links as
+// assets/<hash><ext> resolve to /s/:token/assets/, which serves only those.
+// Unknown tokens count as failed logins, so they cannot be guessed faster
+// than API keys.
+func (s *Server) handleSharePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/s/"), "/")
+	sh, err := s.store.ShareForToken(token)
+	if err != nil {
+		log.Printf("ERROR get share: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if sh == nil {
+		if token != "" {
+			s.authFailed(r, "invalid share token")
+		}
+		http.NotFound(w, r)
+		return
+	}
+	if sh.Expired(time.Now()) {
+		http.NotFound(w, r)
+		return
+	}
+	infoFrom(r).userID = sh.UserID
+
+	note, err := s.store.Get(sh.UserID, sh.Date)
+	if err != nil {
+		log.Printf("ERROR get note %s: %v", sh.Date, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if note == nil || note.Deleted {
+		http.NotFound(w, r)
+		return
+	}
+
+	if file, ok := strings.CutPrefix(rest, "assets/"); ok {
+		s.handleShareAsset(w, r, sh, note, file)
+		return
+	}
+	if rest != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	p, err := dayPage(note)
+	if err != nil {
+		log.Printf("ERROR render note %s: %v", note.Date, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	p.Shared = true
+	p.Base = "/s/" + token + "/"
+
+	w.Header().Set("X-Robots-Tag", "noindex")
+	s.render(w, r, http.StatusOK, "shared", p)
+}
+
+// handleShareAsset serves an attachment of a shared note. Only files the
+// note links to are served, so a link does not expose the rest of the
+// user's attachments.
+func (s *Server) handleShareAsset(w http.ResponseWriter, r *http.Request, sh *store.Share, note *store.Note, file string) {
+	hash, _, _ := strings.Cut(file, ".")
+	if !store.ValidHash(hash) || !strings.Contains(note.Content, "assets/"+file) {
+		http.NotFound(w, r)
+		return
+	}
+
+	a, err := s.store.GetAttachment(sh.UserID, hash)
+	if err != nil {
+		log.Printf("ERROR get attachment %s: %v", hash, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if a == nil || a.Encrypted {
+		http.NotFound(w, r)
+		return
+	}
+
+	serveAttachment(w, r, a)
+}
@@ -0,0 +1,511 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"embed"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/store"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// sessionCookie holds the token of a browser session. Sessions last
+// sessionTTL, or until the API key they were opened with is revoked.
+const (
+	sessionCookie = "scrbl_session"
+	sessionTTL    = 30 * 24 * time.Hour
+)
+
+//go:embed web/templates/*.html
+var templateFS embed.FS
+
+//go:embed web/static
+var staticFS embed.FS
+
+// webTemplates holds one template per page, each combined with the layout.
+var webTemplates = map[string]*template.Template{}
+
+func init() {
+	for _, page := range []string{"days", "day", "search", "login", "shared"} {
+		webTemplates[page] = template.Must(template.ParseFS(templateFS,
+			"web/templates/layout.html", "web/templates/"+page+".html"))
+	}
+}
+
+// markdown renders note content. Raw HTML in notes is omitted, not passed
+// through.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+)
+
+// webPage is the data for every page template.
+type webPage struct {
+	Title    string
+	Query    string
+	LoggedIn bool
+	Error    string
+
+	// Day list.
+	Months []webMonth
+
+	// Day view.
+	Date      string
+	Heading   string
+	Body      template.HTML
+	Encrypted bool
+	Prev      string
+	Next      string
+	UpdatedAt string
+
+	// Shared day, served without a session: Base is the <base> URL its
+	// attachments resolve against.
+	Shared bool
+	Base   string
+
+	// Search.
+	From    string
+	To      string
+	Results []webResult
+	MoreURL string
+
+	// Login.
+	Redirect string
+}
+
+type webMonth struct {
+	Label string
+	Days  []webDay
+}
+
+type webDay struct {
+	Date    string
+	Weekday string
+}
+
+type webResult struct {
+	Date    string
+	Snippet template.HTML
+}
+
+func (s *Server) webRoutes() {
+	static, _ := fs.Sub(staticFS, "web/static")
+
+	s.mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ui/", http.StatusFound)
+	})
+	s.mux.HandleFunc("/ui/", s.webAuth(s.handleWebDays))
+	s.mux.HandleFunc("/ui/day/", s.webAuth(s.handleWebDay))
+	s.mux.HandleFunc("/ui/search", s.webAuth(s.handleWebSearch))
+	s.mux.HandleFunc("/ui/login", s.handleWebLogin)
+	s.mux.HandleFunc("/ui/logout", s.handleWebLogout)
+	s.mux.Handle("/ui/static/", http.StripPrefix("/ui/static/", http.FileServerFS(static)))
+}
+
+// webAuth is auth for browsers: the session comes from the cookie set by
+// the login page, and requests without a valid one are sent there.
+func (s *Server) webAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			token = c.Value
+		}
+
+		id, scopes, status := s.authenticateSession(r, token)
+		switch status {
+		case 0:
+			if !slices.Contains(scopes, store.ScopeRead) {
+				http.Error(w, scopeError(store.ScopeRead), http.StatusForbidden)
+				return
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), userKey, id)))
+			return
+		case http.StatusForbidden:
+			s.authFailed(r, "invalid session")
+			s.clearSessionCookie(w, r)
+		case http.StatusUnauthorized:
+		default:
+			http.Error(w, "internal error", status)
+			return
+		}
+
+		http.Redirect(w, r, "/ui/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+	}
+}
+
+// authenticateSession is authenticate for a session token. A session acts
+// as the key it was opened with, so it ends when that key is revoked, or
+// when the server restarts with a different -api-key.
+func (s *Server) authenticateSession(r *http.Request, token string) (int64, []string, int) {
+	if token != "" {
+		hash, err := s.store.SessionKeyHash(token)
+		if err != nil {
+			log.Printf("ERROR auth: %v", err)
+			return 0, nil, http.StatusInternalServerError
+		}
+		if hash != "" && s.apiKey != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(store.HashKey(s.apiKey))) == 1 {
+			s.limiter.succeed(infoFrom(r).clientIP)
+			infoFrom(r).userID = store.DefaultUserID
+			return store.DefaultUserID, store.AllScopes, 0
+		}
+		if hash != "" {
+			user, scopes, err := s.store.UserForKeyHash(hash)
+			if err != nil {
+				log.Printf("ERROR auth: %v", err)
+				return 0, nil, http.StatusInternalServerError
+			}
+			if user != nil {
+				s.limiter.succeed(infoFrom(r).clientIP)
+				infoFrom(r).userID = user.ID
+				return user.ID, scopes, 0
+			}
+		}
+	}
+
+	// Without a usable session this is the same as having no key: fine
+	// until keys exist, and a stale cookie is an invalid key after that.
+	id, scopes, status := s.authenticate(r, "")
+	if status == http.StatusUnauthorized && token != "" {
+		status = http.StatusForbidden
+	}
+	return id, scopes, status
+}
+
+// GET /ui/ — every day with a note, newest first
+func (s *Server) handleWebDays(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ui/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dates, err := s.store.ListDates(userID(r))
+	if err != nil {
+		log.Printf("ERROR list dates: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var months []webMonth
+	for _, date := range dates {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			continue
+		}
+		label := day.Format("January 2006")
+		if len(months) == 0 || months[len(months)-1].Label != label {
+			months = append(months, webMonth{Label: label})
+		}
+		m := &months[len(months)-1]
+		m.Days = append(m.Days, webDay{Date: date, Weekday: day.Format("Mon 2")})
+	}
+
+	s.render(w, r, http.StatusOK, "days", webPage{Title: "Notes", Months: months})
+}
+
+// GET /ui/day/:date — one day rendered as HTML
+func (s *Server) handleWebDay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	date := strings.TrimPrefix(r.URL.Path, "/ui/day/")
+	if file, ok := strings.CutPrefix(date, "assets/"); ok {
+		s.handleWebAsset(w, r, file)
+		return
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	note, err := s.store.Get(userID(r), date)
+	if err != nil {
+		log.Printf("ERROR get note %s: %v", date, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if note == nil || note.Deleted {
+		http.NotFound(w, r)
+		return
+	}
+
+	dates, err := s.store.ListDates(userID(r))
+	if err != nil {
+		log.Printf("ERROR list dates: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	p, err := dayPage(note)
+	if err != nil {
+		log.Printf("ERROR render note %s: %v", date, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	// dates is newest first.
+	if i := slices.Index(dates, date); i >= 0 {
+		if i+1 < len(dates) {
+			p.Prev = dates[i+1]
+		}
+		if i > 0 {
+			p.Next = dates[i-1]
+		}
+	}
+
+	s.render(w, r, http.StatusOK, "day", p)
+}
+
+// dayPage renders a note for the day view and share links. Encrypted notes
+// are only marked as such.
+func dayPage(note *store.Note) (webPage, error) {
+	p := webPage{
+		Title:     note.Date,
+		Date:      note.Date,
+		Heading:   note.Date,
+		UpdatedAt: note.UpdatedAt,
+	}
+	if day, err := time.Parse("2006-01-02", note.Date); err == nil {
+		p.Heading = day.Format("Monday, 2 January 2006")
+	}
+
+	if strings.HasPrefix(note.Content, store.EncryptedPrefix) {
+		p.Encrypted = true
+		return p, nil
+	}
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(note.Content), &buf); err != nil {
+		return p, err
+	}
+	p.Body = template.HTML(buf.String())
+	return p, nil
+}
+
+// GET /ui/day/assets/:hash[.ext] — an attachment linked from a day
+//
+// Notes link attachments relative to the day file, as assets/<hash><ext>,
+// which from a day page resolves here. Encrypted attachments cannot be shown.
+func (s *Server) handleWebAsset(w http.ResponseWriter, r *http.Request, file string) {
+	hash, _, _ := strings.Cut(file, ".")
+	if !store.ValidHash(hash) {
+		http.NotFound(w, r)
+		return
+	}
+
+	a, err := s.store.GetAttachment(userID(r), hash)
+	if err != nil {
+		log.Printf("ERROR get attachment %s: %v", hash, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if a == nil || a.Encrypted {
+		http.NotFound(w, r)
+		return
+	}
+
+	serveAttachment(w, r, a)
+}
+
+// GET /ui/search?q=query[&from=YYYY-MM-DD][&to=YYYY-MM-DD]
+func (s *Server) handleWebSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	q := store.SearchQuery{
+		Text: strings.TrimSpace(params.Get("q")),
+		From: params.Get("from"),
+		To:   params.Get("to"),
+	}
+	p := webPage{Title: "Search", Query: q.Text, From: q.From, To: q.To}
+	if q.Text == "" {
+		s.render(w, r, http.StatusOK, "search", p)
+		return
+	}
+	p.Title = "Search: " + q.Text
+
+	encrypted, err := s.store.HasEncryptedNotes(userID(r))
+	if err != nil {
+		log.Printf("ERROR search: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if encrypted {
+		p.Error = "Search is unavailable for encrypted notebooks."
+		s.render(w, r, http.StatusNotImplemented, "search", p)
+		return
+	}
+
+	page := store.Page{Limit: store.SearchLimit, Cursor: params.Get("cursor")}
+	results, next, err := s.store.SearchPage(userID(r), q, page)
+	if errors.Is(err, store.ErrInvalidQuery) || errors.Is(err, store.ErrInvalidCursor) {
+		p.Error = "Invalid search query."
+		s.render(w, r, http.StatusBadRequest, "search", p)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR search: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, res := range results {
+		p.Results = append(p.Results, webResult{Date: res.Date, Snippet: highlightSnippet(res.Snippet)})
+	}
+	if next != "" {
+		more := url.Values{"q": {q.Text}, "cursor": {next}}
+		if q.From != "" {
+			more.Set("from", q.From)
+		}
+		if q.To != "" {
+			more.Set("to", q.To)
+		}
+		p.MoreURL = "/ui/search?" + more.Encode()
+	}
+	s.render(w, r, http.StatusOK, "search", p)
+}
+
+// GET/POST /ui/login — trade an API key for a session cookie
+//
+// The cookie holds an opaque session token rather than the key, so a
+// leaked cookie cannot be used against the API.
+func (s *Server) handleWebLogin(w http.ResponseWriter, r *http.Request) {
+	redirect := r.FormValue("next")
+	if !strings.HasPrefix(redirect, "/ui/") {
+		redirect = "/ui/"
+	}
+	p := webPage{Title: "Sign in", Redirect: redirect}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.render(w, r, http.StatusOK, "login", p)
+	case http.MethodPost:
+		key := strings.TrimSpace(r.PostFormValue("key"))
+		_, scopes, status := s.authenticate(r, key)
+		switch {
+		case status == 0 && !slices.Contains(scopes, store.ScopeRead):
+			p.Error = "This API key lacks the read scope."
+			s.render(w, r, http.StatusForbidden, "login", p)
+		case status == 0:
+			token, err := s.store.CreateSession(key, sessionTTL)
+			if err != nil {
+				log.Printf("ERROR login: %v", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    token,
+				Path:     "/ui/",
+				MaxAge:   int(sessionTTL.Seconds()),
+				HttpOnly: true,
+				Secure:   s.secureRequest(r),
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, redirect, http.StatusSeeOther)
+		case status == http.StatusUnauthorized, status == http.StatusForbidden:
+			if key != "" {
+				s.authFailed(r, "invalid api key")
+			}
+			p.Error = "Invalid API key."
+			s.render(w, r, http.StatusForbidden, "login", p)
+		default:
+			http.Error(w, "internal error", status)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST /ui/logout — end the session and drop its cookie
+func (s *Server) handleWebLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if err := s.store.DeleteSession(c.Value); err != nil {
+			log.Printf("ERROR logout: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+	s.clearSessionCookie(w, r)
+	http.Redirect(w, r, "/ui/login", http.StatusSeeOther)
+}
+
+func (s *Server) clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/ui/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// secureRequest reports whether the browser reached us over HTTPS, either
+// directly or through a trusted proxy that says so in X-Forwarded-Proto.
+func (s *Server) secureRequest(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return s.trustedProxy(host) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// render executes a page template into a buffer first, so template errors
+// become a 500 instead of a truncated page.
+func (s *Server) render(w http.ResponseWriter, r *http.Request, status int, page string, p webPage) {
+	if _, err := r.Cookie(sessionCookie); err == nil {
+		p.LoggedIn = true
+	}
+
+	var buf bytes.Buffer
+	if err := webTemplates[page].ExecuteTemplate(&buf, "layout", p); err != nil {
+		log.Printf("ERROR render %s: %v", page, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "private, no-cache")
+	h.Set("Content-Security-Policy", "default-src 'self'; img-src 'self' data: https:; frame-ancestors 'none'")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Referrer-Policy", "same-origin")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// highlightSnippet escapes a search snippet, keeping only the <mark> tags
+// the store put around matches.
+func highlightSnippet(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, template.HTMLEscapeString("<mark>"), "<mark>")
+	escaped = strings.ReplaceAll(escaped, template.HTMLEscapeString("</mark>"), "</mark>")
+	return template.HTML(escaped)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+	"github.com/juliuswalton/scrbl-server/store"
+)
+
+// The store's types are its own; handlers convert them to the apiv1 wire
+// types before encoding, so a change to the schema cannot change the API by
+// accident.
+
+// GET /api/openapi.json — the OpenAPI document describing this API
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(apiv1.OpenAPI)
+}
+
+func wireNote(n *store.Note) *apiv1.Note {
+	if n == nil {
+		return nil
+	}
+	return &apiv1.Note{
+		Date:      n.Date,
+		Content:   n.Content,
+		Revision:  n.Revision,
+		UpdatedAt: n.UpdatedAt,
+		Deleted:   n.Deleted,
+	}
+}
+
+func wireNotes(notes []store.Note) []apiv1.Note {
+	out := make([]apiv1.Note, len(notes))
+	for i := range notes {
+		out[i] = *wireNote(&notes[i])
+	}
+	return out
+}
+
+func wireRevision(r *store.Revision) apiv1.Revision {
+	return apiv1.Revision{
+		Date:      r.Date,
+		Revision:  r.Revision,
+		Content:   r.Content,
+		Size:      r.Size,
+		CreatedAt: r.CreatedAt,
+		Deleted:   r.Deleted,
+	}
+}
+
+func wireRevisions(revs []store.Revision) []apiv1.Revision {
+	out := make([]apiv1.Revision, len(revs))
+	for i := range revs {
+		out[i] = wireRevision(&revs[i])
+	}
+	return out
+}
+
+func wireSearchResults(results []store.SearchResult) []apiv1.SearchResult {
+	out := make([]apiv1.SearchResult, len(results))
+	for i, r := range results {
+		matches := make([]apiv1.Span, len(r.Matches))
+		for j, m := range r.Matches {
+			matches[j] = apiv1.Span{Start: m.Start, End: m.End}
+		}
+		out[i] = apiv1.SearchResult{
+			Date:      r.Date,
+			Snippet:   r.Snippet,
+			Matches:   matches,
+			Score:     r.Score,
+			UpdatedAt: r.UpdatedAt,
+		}
+	}
+	return out
+}
+
+func wireChange(c store.Change) apiv1.NoteChange {
+	return apiv1.NoteChange{
+		Date:      c.Date,
+		Revision:  c.Revision,
+		UpdatedAt: c.UpdatedAt,
+		Deleted:   c.Deleted,
+	}
+}
+
+func wireAttachment(a *store.Attachment) apiv1.Attachment {
+	return apiv1.Attachment{
+		Hash:        a.Hash,
+		Size:        a.Size,
+		ContentType: a.ContentType,
+		CreatedAt:   a.CreatedAt,
+		Encrypted:   a.Encrypted,
+	}
+}
+
+func wireShare(token string, sh *store.Share) apiv1.Share {
+	return apiv1.Share{
+		Token:     token,
+		Date:      sh.Date,
+		Path:      "/s/" + token,
+		CreatedAt: sh.CreatedAt,
+		ExpiresAt: sh.ExpiresAt,
+	}
+}
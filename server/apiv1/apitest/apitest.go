@@ -0,0 +1,493 @@
+// Package apitest checks HTTP traffic against the OpenAPI document in apiv1,
+// so tests on either side of the API fail when they drift from it. It
+// understands the subset of OpenAPI and JSON Schema the document uses.
+package apitest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// Spec is a loaded OpenAPI document.
+type Spec struct {
+	doc map[string]any
+	ops []*Operation
+}
+
+// Operation is one method of one path in the document.
+type Operation struct {
+	ID     string
+	Method string
+	Path   string
+	// Scopes lists the bearerAuth scopes the operation needs. It is nil
+	// for public operations.
+	Scopes []string
+
+	segments []string
+	op       map[string]any
+	params   []map[string]any
+}
+
+// Load parses an OpenAPI document.
+func Load(data []byte) (*Spec, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi: %w", err)
+	}
+	s := &Spec{doc: doc}
+
+	paths, _ := doc["paths"].(map[string]any)
+	for path, raw := range paths {
+		item, _ := raw.(map[string]any)
+		for method, raw := range item {
+			op, ok := raw.(map[string]any)
+			if !ok || method == "parameters" {
+				continue
+			}
+			o := &Operation{
+				Method:   strings.ToUpper(method),
+				Path:     path,
+				segments: strings.Split(path, "/"),
+				op:       op,
+			}
+			o.ID, _ = op["operationId"].(string)
+			if o.ID == "" {
+				return nil, fmt.Errorf("%s %s has no operationId", o.Method, path)
+			}
+			o.Scopes = bearerScopes(doc["security"])
+			if security, ok := op["security"]; ok {
+				o.Scopes = bearerScopes(security)
+			}
+			for _, list := range []any{item["parameters"], op["parameters"]} {
+				params, _ := list.([]any)
+				for _, p := range params {
+					o.params = append(o.params, s.resolve(p))
+				}
+			}
+			s.ops = append(s.ops, o)
+		}
+	}
+	sort.Slice(s.ops, func(i, j int) bool { return s.ops[i].ID < s.ops[j].ID })
+	return s, nil
+}
+
+// bearerScopes returns the scopes of the bearerAuth requirement in a
+// security list, or nil if it has none.
+func bearerScopes(security any) []string {
+	list, _ := security.([]any)
+	for _, req := range list {
+		req, _ := req.(map[string]any)
+		raw, ok := req["bearerAuth"].([]any)
+		if !ok {
+			continue
+		}
+		scopes := []string{}
+		for _, s := range raw {
+			scopes = append(scopes, s.(string))
+		}
+		return scopes
+	}
+	return nil
+}
+
+// Default loads apiv1.OpenAPI, panicking if it is malformed.
+func Default() *Spec {
+	s, err := Load(apiv1.OpenAPI)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Operations returns every operation in the document, sorted by ID.
+func (s *Spec) Operations() []*Operation {
+	return s.ops
+}
+
+// Schema returns the named schema from components/schemas, or nil.
+func (s *Spec) Schema(name string) map[string]any {
+	schema, _ := s.lookup("#/components/schemas/" + name).(map[string]any)
+	return schema
+}
+
+// Find returns the operation serving method and path. Paths with literal
+// segments win over templates, so /api/notes/batch is not a date.
+func (s *Spec) Find(method, path string) (*Operation, error) {
+	segments := strings.Split(path, "/")
+	var best *Operation
+	bestLiterals := -1
+	for _, o := range s.ops {
+		if o.Method != method || len(o.segments) != len(segments) {
+			continue
+		}
+		literals, ok := 0, true
+		for i, seg := range o.segments {
+			switch {
+			case isTemplate(seg):
+				ok = ok && segments[i] != ""
+			case seg == segments[i]:
+				literals++
+			default:
+				ok = false
+			}
+		}
+		if ok && literals > bestLiterals {
+			best, bestLiterals = o, literals
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%s %s is not documented", method, path)
+	}
+	return best, nil
+}
+
+// CheckRequest finds the operation a request is for and checks its
+// parameters and body against it.
+func (s *Spec) CheckRequest(r *http.Request, body []byte) (*Operation, error) {
+	o, err := s.Find(r.Method, r.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+	where := o.Method + " " + o.Path
+
+	segments := strings.Split(r.URL.Path, "/")
+	query := r.URL.Query()
+	known := map[string]bool{}
+	for _, p := range o.params {
+		name, _ := p["name"].(string)
+		schema, _ := p["schema"].(map[string]any)
+		switch p["in"] {
+		case "path":
+			i := slices.Index(o.segments, "{"+name+"}")
+			if err := s.checkParam(schema, segments[i]); err != nil {
+				return o, fmt.Errorf("%s: path parameter %s: %w", where, name, err)
+			}
+		case "query":
+			known[name] = true
+			if !query.Has(name) {
+				if p["required"] == true {
+					return o, fmt.Errorf("%s: missing query parameter %s", where, name)
+				}
+				continue
+			}
+			if err := s.checkParam(schema, query.Get(name)); err != nil {
+				return o, fmt.Errorf("%s: query parameter %s: %w", where, name, err)
+			}
+		}
+	}
+	for name := range query {
+		if !known[name] {
+			return o, fmt.Errorf("%s: undocumented query parameter %s", where, name)
+		}
+	}
+
+	reqBody := s.resolve(o.op["requestBody"])
+	if reqBody == nil {
+		if len(body) > 0 {
+			return o, fmt.Errorf("%s: takes no request body", where)
+		}
+		return o, nil
+	}
+	if len(body) == 0 {
+		if reqBody["required"] == true {
+			return o, fmt.Errorf("%s: missing request body", where)
+		}
+		return o, nil
+	}
+	content, _ := reqBody["content"].(map[string]any)
+	if err := s.checkContent(content, r.Header.Get("Content-Type"), body); err != nil {
+		return o, fmt.Errorf("%s: request body: %w", where, err)
+	}
+	return o, nil
+}
+
+// CheckResponse checks a response to an operation: its status must be
+// documented, and its body must match the documented media type and schema.
+func (s *Spec) CheckResponse(o *Operation, status int, h http.Header, body []byte) error {
+	where := fmt.Sprintf("%s %s: %d response", o.Method, o.Path, status)
+
+	responses, _ := o.op["responses"].(map[string]any)
+	resp := s.resolve(responses[strconv.Itoa(status)])
+	if resp == nil {
+		return fmt.Errorf("%s is not documented", where)
+	}
+	if o.Method == http.MethodHead || status == http.StatusNotModified {
+		return nil
+	}
+
+	content, _ := resp["content"].(map[string]any)
+	if content == nil {
+		if len(body) > 0 {
+			return fmt.Errorf("%s: documented without a body", where)
+		}
+		return nil
+	}
+
+	if h.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+		if body, err = io.ReadAll(zr); err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+	}
+	if err := s.checkContent(content, h.Get("Content-Type"), body); err != nil {
+		return fmt.Errorf("%s: %w", where, err)
+	}
+	return nil
+}
+
+// CheckValue checks a Go value, encoded as JSON, against a named schema.
+func (s *Spec) CheckValue(name string, v any) error {
+	schema := s.Schema(name)
+	if schema == nil {
+		return fmt.Errorf("no schema %s", name)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.checkJSON(schema, data)
+}
+
+// checkContent matches a Content-Type against a content map and validates
+// JSON bodies against their schema.
+func (s *Spec) checkContent(content map[string]any, contentType string, body []byte) error {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q", contentType)
+	}
+	media, ok := content[mt].(map[string]any)
+	if !ok {
+		major, _, _ := strings.Cut(mt, "/")
+		media, ok = content[major+"/*"].(map[string]any)
+	}
+	if !ok {
+		media, ok = content["*/*"].(map[string]any)
+	}
+	if !ok {
+		return fmt.Errorf("undocumented Content-Type %s", mt)
+	}
+
+	if mt != "application/json" {
+		return nil
+	}
+	schema, _ := media["schema"].(map[string]any)
+	return s.checkJSON(schema, body)
+}
+
+func (s *Spec) checkJSON(schema map[string]any, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	return s.validate(schema, v, "$")
+}
+
+// checkParam validates a path or query parameter, converting it to the
+// schema's type first.
+func (s *Spec) checkParam(schema map[string]any, raw string) error {
+	var v any = raw
+	switch schema["type"] {
+	case "integer", "number":
+		v = json.Number(raw)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		v = b
+	}
+	return s.validate(schema, v, "value")
+}
+
+// validate checks a decoded JSON value against a schema.
+func (s *Spec) validate(schema map[string]any, v any, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, _ := s.lookup(ref).(map[string]any)
+		if target == nil {
+			return fmt.Errorf("%s: unresolved $ref %s", at, ref)
+		}
+		return s.validate(target, v, at)
+	}
+
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, alt := range anyOf {
+			alt, _ := alt.(map[string]any)
+			if s.validate(alt, v, at) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: matches none of the anyOf schemas", at)
+	}
+
+	if t, ok := schema["type"]; ok {
+		types, ok := t.([]any)
+		if !ok {
+			types = []any{t}
+		}
+		if !slices.ContainsFunc(types, func(t any) bool { return hasType(v, t.(string)) }) {
+			return fmt.Errorf("%s: %s is not of type %v", at, describe(v), t)
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(v) }) {
+			return fmt.Errorf("%s: %v is not one of %v", at, v, enum)
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return checkString(schema, v, at)
+	case json.Number:
+		if min, ok := schema["minimum"].(float64); ok {
+			if f, _ := v.Float64(); f < min {
+				return fmt.Errorf("%s: %s is less than %v", at, v, min)
+			}
+		}
+	case []any:
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range v {
+			if items == nil {
+				break
+			}
+			if err := s.validate(items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		return s.validateObject(schema, v, at)
+	}
+	return nil
+}
+
+func (s *Spec) validateObject(schema map[string]any, v map[string]any, at string) error {
+	required, _ := schema["required"].([]any)
+	for _, name := range required {
+		if _, ok := v[name.(string)]; !ok {
+			return fmt.Errorf("%s: missing required property %s", at, name)
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, ok := props[name].(map[string]any)
+		if !ok {
+			if schema["additionalProperties"] == false {
+				return fmt.Errorf("%s: undocumented property %s", at, name)
+			}
+			continue
+		}
+		if err := s.validate(prop, v[name], at+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkString(schema map[string]any, v, at string) error {
+	switch schema["format"] {
+	case "date":
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return fmt.Errorf("%s: %q is not a date", at, v)
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			return fmt.Errorf("%s: %q is not a date-time", at, v)
+		}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern %q", at, pattern)
+		}
+		if !re.MatchString(v) {
+			return fmt.Errorf("%s: %q does not match %s", at, v, pattern)
+		}
+	}
+	return nil
+}
+
+func hasType(v any, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		_, err := strconv.ParseInt(string(v), 10, 64)
+		return t == "integer" && err == nil
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	}
+	return false
+}
+
+func describe(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprint(v)
+}
+
+// resolve follows a $ref, if v is one.
+func (s *Spec) resolve(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	if ref, ok := m["$ref"].(string); ok {
+		m, _ = s.lookup(ref).(map[string]any)
+	}
+	return m
+}
+
+// lookup evaluates a local JSON pointer such as #/components/schemas/Note.
+func (s *Spec) lookup(ref string) any {
+	var cur any = s.doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[strings.NewReplacer("~1", "/", "~0", "~").Replace(part)]
+	}
+	return cur
+}
+
+func isTemplate(seg string) bool {
+	return strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")
+}
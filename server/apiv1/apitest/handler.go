@@ -0,0 +1,102 @@
+package apitest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	gosync "sync"
+	"testing"
+)
+
+// Checker is an http.Handler that checks every request and response passing
+// through it against a Spec, reporting violations to a test. It also records
+// which operations were exercised.
+type Checker struct {
+	spec *Spec
+	t    testing.TB
+	next http.Handler
+
+	mu      gosync.Mutex
+	covered map[string]bool
+}
+
+// Check wraps next in a Checker.
+func (s *Spec) Check(t testing.TB, next http.Handler) *Checker {
+	return &Checker{spec: s, t: t, next: next, covered: map[string]bool{}}
+}
+
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		c.t.Errorf("read request body: %v", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	op, err := c.spec.CheckRequest(r, body)
+	if err != nil {
+		c.t.Errorf("request does not match the spec: %v", err)
+	}
+
+	cw := &captureWriter{ResponseWriter: w}
+	c.next.ServeHTTP(cw, r)
+	if op == nil {
+		return
+	}
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if err := c.spec.CheckResponse(op, cw.status, w.Header(), cw.body.Bytes()); err != nil {
+		c.t.Errorf("response does not match the spec: %v", err)
+	}
+	c.mu.Lock()
+	c.covered[op.ID] = true
+	c.mu.Unlock()
+}
+
+// Uncovered returns the IDs of the operations no request has exercised yet,
+// other than those in skip.
+func (c *Checker) Uncovered(skip ...string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ids []string
+	for _, op := range c.spec.Operations() {
+		if !c.covered[op.ID] && !slices.Contains(skip, op.ID) {
+			ids = append(ids, op.ID)
+		}
+	}
+	return ids
+}
+
+// captureWriter keeps a copy of a response while passing it through. It
+// flushes and unwraps so streaming handlers keep working.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
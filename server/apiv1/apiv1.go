@@ -0,0 +1,160 @@
+// Package apiv1 defines the JSON wire format of the scrbl server API, shared
+// by the server and the client in the sync package, and embeds the OpenAPI
+// document describing it.
+//
+// Changes within v1 must be backwards compatible: fields and endpoints may be
+// added, but not renamed, removed or given a different meaning. Every type
+// here has a schema of the same name in openapi.json, and the contract tests
+// fail when the two disagree.
+package apiv1
+
+import _ "embed"
+
+// Version is the API version served in the OpenAPI document. Its minor part
+// grows with every backwards compatible addition.
+const Version = "1.2.0"
+
+// OpenAPI is the OpenAPI 3.1 document served at /api/openapi.json.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// EncryptedPrefix marks content encrypted by the client before upload. The
+// server never decrypts it; it only needs to know that such content exists.
+const EncryptedPrefix = "scrbl-enc:v1:"
+
+// Scopes an API key may be granted. Each operation in openapi.json lists the
+// one it needs: read for GET and HEAD, write for every other method, admin
+// for /api/admin.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// Health is the response to GET /health.
+type Health struct {
+	Status string `json:"status"`
+}
+
+// Note is a day's note. Deleted notes are tombstones with empty content.
+type Note struct {
+	Date      string `json:"date"`
+	Content   string `json:"content"`
+	Revision  int64  `json:"revision"`
+	UpdatedAt string `json:"updated_at"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+// PutNoteRequest is the body of PUT /api/notes/:date and one note of a batch.
+type PutNoteRequest struct {
+	Date    string `json:"date"`
+	Content string `json:"content"`
+	// BaseRevision is the revision the client last saw. When omitted the
+	// write is unconditional.
+	BaseRevision *int64 `json:"base_revision,omitempty"`
+}
+
+// BatchRequest is the body of POST /api/notes/batch.
+type BatchRequest struct {
+	Notes []PutNoteRequest `json:"notes"`
+}
+
+// Batch result statuses.
+const (
+	BatchOK       = "ok"
+	BatchConflict = "conflict"
+	BatchError    = "error"
+)
+
+// BatchResult is the outcome of one note of a batch. Note is the saved note,
+// or the current server copy on a conflict.
+type BatchResult struct {
+	Date   string `json:"date"`
+	Status string `json:"status"`
+	Note   *Note  `json:"note,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchResponse is the response to POST /api/notes/batch, one result per
+// note in request order.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// Page is one page of a paginated listing. NextCursor, passed back as
+// ?cursor=, fetches the following page; it is omitted on the last one.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Revision is a historical version of a day's note. Listings leave out
+// Content.
+type Revision struct {
+	Date      string `json:"date"`
+	Revision  int64  `json:"revision"`
+	Content   string `json:"content,omitempty"`
+	Size      int    `json:"size"`
+	CreatedAt string `json:"created_at"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+// SearchResult is one note matched by a full-text query. Snippet wraps
+// matches in <mark> tags; Matches holds their byte offsets in the note.
+type SearchResult struct {
+	Date      string  `json:"date"`
+	Snippet   string  `json:"snippet"`
+	Matches   []Span  `json:"matches"`
+	Score     float64 `json:"score"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+// Span is a byte range [Start, End) of note content.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Event types sent on GET /api/events.
+const (
+	// EventReady is sent once the subscription is active.
+	EventReady = "ready"
+	// EventNote is sent for every write to a note, with a NoteChange.
+	EventNote = "note"
+)
+
+// NoteChange is the data of a note event: a write to a note, without its
+// content.
+type NoteChange struct {
+	Date      string `json:"date"`
+	Revision  int64  `json:"revision"`
+	UpdatedAt string `json:"updated_at"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+// Attachment describes a file stored with PUT /api/attachments/:hash.
+// Encrypted marks data sealed by the client.
+type Attachment struct {
+	Hash        string `json:"hash"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	CreatedAt   string `json:"created_at"`
+	Encrypted   bool   `json:"encrypted,omitempty"`
+}
+
+// ShareRequest is the optional body of POST /api/notes/:date/share. Without
+// ExpiresAt the link works until it is revoked.
+type ShareRequest struct {
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// Share is a public link to one day's note, served without an API key at
+// Path. The token is only returned when the share is created.
+type Share struct {
+	Token     string `json:"token"`
+	Date      string `json:"date"`
+	Path      string `json:"path"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
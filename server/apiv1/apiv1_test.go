@@ -0,0 +1,141 @@
+package apiv1_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+	"github.com/juliuswalton/scrbl-server/apiv1/apitest"
+)
+
+// TestSchemasMatchTypes checks that every wire type has a schema with the
+// same properties, required exactly when the field is not omitempty, and of
+// the same JSON type.
+func TestSchemasMatchTypes(t *testing.T) {
+	spec := apitest.Default()
+
+	types := map[string]any{
+		"Health":         apiv1.Health{},
+		"Note":           apiv1.Note{},
+		"PutNoteRequest": apiv1.PutNoteRequest{},
+		"BatchRequest":   apiv1.BatchRequest{},
+		"BatchResult":    apiv1.BatchResult{},
+		"BatchResponse":  apiv1.BatchResponse{},
+		"DatePage":       apiv1.Page[string]{},
+		"NotePage":       apiv1.Page[apiv1.Note]{},
+		"SearchPage":     apiv1.Page[apiv1.SearchResult]{},
+		"Revision":       apiv1.Revision{},
+		"SearchResult":   apiv1.SearchResult{},
+		"Span":           apiv1.Span{},
+		"NoteChange":     apiv1.NoteChange{},
+		"Attachment":     apiv1.Attachment{},
+		"ShareRequest":   apiv1.ShareRequest{},
+		"Share":          apiv1.Share{},
+	}
+
+	for name, v := range types {
+		t.Run(name, func(t *testing.T) {
+			schema := spec.Schema(name)
+			if schema == nil {
+				t.Fatalf("openapi.json has no schema %s", name)
+			}
+			if schema["additionalProperties"] != false {
+				t.Errorf("schema %s allows additional properties", name)
+			}
+			props, _ := schema["properties"].(map[string]any)
+			var required []string
+			for _, r := range schema["required"].([]any) {
+				required = append(required, r.(string))
+			}
+
+			seen := map[string]bool{}
+			rt := reflect.TypeOf(v)
+			for i := range rt.NumField() {
+				f := rt.Field(i)
+				tag := f.Tag.Get("json")
+				field, opts, _ := strings.Cut(tag, ",")
+				if field == "-" || !f.IsExported() {
+					continue
+				}
+				seen[field] = true
+
+				prop, ok := props[field].(map[string]any)
+				if !ok {
+					t.Errorf("%s.%s: no property %q in the schema", name, f.Name, field)
+					continue
+				}
+				if want := !strings.Contains(opts, "omitempty"); slices.Contains(required, field) != want {
+					t.Errorf("%s.%s: required in schema = %v, want %v", name, f.Name, !want, want)
+				}
+				if got, want := schemaType(prop), jsonType(f.Type); got != want {
+					t.Errorf("%s.%s: schema type %s, want %s", name, f.Name, got, want)
+				}
+			}
+			for field := range props {
+				if !seen[field] {
+					t.Errorf("schema %s has property %q missing from the Go type", name, field)
+				}
+			}
+		})
+	}
+}
+
+// TestOpenAPIDocument checks the document's version and that every
+// operation has an ID.
+func TestOpenAPIDocument(t *testing.T) {
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(apiv1.OpenAPI, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.1") {
+		t.Errorf("openapi = %q, want 3.1.x", doc.OpenAPI)
+	}
+	if doc.Info.Version != apiv1.Version {
+		t.Errorf("info.version = %q, want apiv1.Version %q", doc.Info.Version, apiv1.Version)
+	}
+
+	spec, err := apitest.Load(apiv1.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Operations()) == 0 {
+		t.Fatal("no operations")
+	}
+}
+
+func schemaType(prop map[string]any) string {
+	if _, ok := prop["$ref"]; ok {
+		return "object"
+	}
+	t, _ := prop["type"].(string)
+	return t
+}
+
+func jsonType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "array"
+	case reflect.Struct:
+		return "object"
+	}
+	return t.Kind().String()
+}
@@ -2,7 +2,10 @@ module github.com/juliuswalton/scrbl-server
 
 go 1.24.5
 
-require modernc.org/sqlite v1.44.3
+require (
+	github.com/yuin/goldmark v1.7.8
+	modernc.org/sqlite v1.44.3
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
@@ -1,44 +1,212 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/juliuswalton/scrbl-server/api"
 	"github.com/juliuswalton/scrbl-server/store"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		if err := runAdmin(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	port := flag.String("port", envOr("PORT", "8080"), "server port")
 	dbPath := flag.String("db", envOr("DB_PATH", "./scrbl.db"), "SQLite database path")
-	apiKey := flag.String("api-key", envOr("API_KEY", ""), "API key for authentication (empty = no auth)")
+	apiKey := flag.String("api-key", envOr("API_KEY", ""), "API key for the default user (empty = rely on keys created with admin users add)")
+	logFormat := flag.String("log-format", envOr("LOG_FORMAT", "text"), "access log format: text, json or off")
+	tlsCert := flag.String("tls-cert", envOr("TLS_CERT", ""), "TLS certificate file (serve HTTPS when set with -tls-key)")
+	tlsKey := flag.String("tls-key", envOr("TLS_KEY", ""), "TLS private key file")
+	readTimeout := flag.Duration("read-timeout", envDuration("READ_TIMEOUT", 30*time.Second), "max time to read a request, including the body")
+	writeTimeout := flag.Duration("write-timeout", envDuration("WRITE_TIMEOUT", 60*time.Second), "max time to write a response")
+	idleTimeout := flag.Duration("idle-timeout", envDuration("IDLE_TIMEOUT", 120*time.Second), "max time to keep an idle connection open")
+	shutdownTimeout := flag.Duration("shutdown-timeout", envDuration("SHUTDOWN_TIMEOUT", 8*time.Second), "max time to drain in-flight requests on shutdown")
+	rateLimit := flag.Float64("rate-limit", envFloat("RATE_LIMIT", 20), "requests per second allowed per client IP (0 = unlimited)")
+	rateBurst := flag.Int("rate-burst", envInt("RATE_BURST", 100), "burst size for -rate-limit")
+	lockoutThreshold := flag.Int("lockout-threshold", envInt("LOCKOUT_THRESHOLD", 10), "failed auth attempts before a client IP is locked out (0 = never)")
+	lockoutDuration := flag.Duration("lockout-duration", envDuration("LOCKOUT_DURATION", 15*time.Minute), "how long a locked out client IP is refused")
+	maxAttachmentSize := flag.Int64("max-attachment-size", int64(envInt("MAX_ATTACHMENT_SIZE", api.DefaultMaxAttachmentSize)), "largest attachment upload accepted, in bytes")
+	backupDir := flag.String("backup-dir", envOr("BACKUP_DIR", ""), "directory for automatic daily and weekly backups (empty = off)")
+	backupDaily := flag.Int("backup-daily", envInt("BACKUP_DAILY", 7), "daily backups to keep")
+	backupWeekly := flag.Int("backup-weekly", envInt("BACKUP_WEEKLY", 4), "weekly backups to keep")
+	trustedProxies := flag.String("trusted-proxies", envOr("TRUSTED_PROXIES", ""), "comma-separated IPs or CIDRs allowed to set X-Forwarded-For")
 	flag.Parse()
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatalf("-tls-cert and -tls-key must be set together")
+	}
+
+	proxies, err := parsePrefixes(*trustedProxies)
+	if err != nil {
+		log.Fatalf("invalid -trusted-proxies: %v", err)
+	}
+
 	// Open database
 	s, err := store.New(*dbPath)
 	if err != nil {
 		log.Fatalf("failed to open database: %v", err)
 	}
-	defer s.Close()
+
+	accessLog, err := newAccessLog(*logFormat)
+	if err != nil {
+		log.Fatalf("invalid -log-format: %v", err)
+	}
+
+	// A key passed on the command line keeps working for single-user setups
+	// by belonging to the default user, who owns notes from before users.
+	// It is the operator's key, so it gets every scope. It is checked in
+	// memory, so changing it cuts off the old one.
+	keyed := *apiKey != ""
+	if !keyed {
+		if keyed, err = s.HasAPIKeys(); err != nil {
+			log.Fatalf("failed to check api keys: %v", err)
+		}
+	}
 
 	// Create API server
-	srv := api.New(s, *apiKey)
+	srv := api.New(s, api.Options{
+		AccessLog:        accessLog,
+		RateLimit:        *rateLimit,
+		RateBurst:        *rateBurst,
+		LockoutThreshold: *lockoutThreshold,
+		LockoutDuration:  *lockoutDuration,
+		TrustedProxies:   proxies,
+
+		MaxAttachmentSize: *maxAttachmentSize,
+		APIKey:            *apiKey,
+	})
 
-	addr := fmt.Sprintf(":%s", *port)
-	log.Printf("scrbl-server listening on %s", addr)
-	if *apiKey != "" {
+	httpSrv := &http.Server{
+		Addr:              fmt.Sprintf(":%s", *port),
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+
+	scheme := "http"
+	if *tlsCert != "" {
+		scheme = "https"
+	}
+	log.Printf("scrbl-server listening on %s (%s)", httpSrv.Addr, scheme)
+	if keyed {
 		log.Printf("API key authentication enabled")
 	} else {
 		log.Printf("WARNING: no API key set, server is unauthenticated")
 	}
 
-	if err := http.ListenAndServe(addr, srv.Handler()); err != nil {
+	httpSrv.RegisterOnShutdown(srv.CloseStreams)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if *tlsCert != "" {
+			serveErr <- httpSrv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			serveErr <- httpSrv.ListenAndServe()
+		}
+	}()
+
+	backupsDone := make(chan struct{})
+	if *backupDir != "" {
+		policy := store.BackupPolicy{Dir: *backupDir, Daily: *backupDaily, Weekly: *backupWeekly}
+		log.Printf("backups enabled in %s (keeping %d daily, %d weekly)", policy.Dir, policy.Daily, policy.Weekly)
+		go func() {
+			defer close(backupsDone)
+			scheduleBackups(ctx, s, policy)
+		}()
+	} else {
+		close(backupsDone)
+	}
+
+	select {
+	case err := <-serveErr:
+		s.Close()
 		log.Fatalf("server error: %v", err)
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and let in-flight writes finish before the
+	// database is closed.
+	log.Printf("shutting down, draining requests for up to %s", *shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("ERROR shutdown: %v", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("ERROR server: %v", err)
+	}
+
+	// A backup in progress finishes before the database is closed.
+	<-backupsDone
+	if err := s.Close(); err != nil {
+		log.Printf("ERROR close database: %v", err)
+	}
+	log.Printf("shutdown complete")
+}
+
+// backupCheckInterval is how often the scheduler looks for a due backup.
+const backupCheckInterval = time.Hour
+
+// scheduleBackups takes due backups at startup and then every
+// backupCheckInterval until ctx is done.
+func scheduleBackups(ctx context.Context, s *store.Store, policy store.BackupPolicy) {
+	ticker := time.NewTicker(backupCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		created, err := s.RunBackups(policy, time.Now())
+		for _, path := range created {
+			log.Printf("backup written to %s", path)
+		}
+		if err != nil {
+			log.Printf("ERROR backup: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newAccessLog returns a structured logger writing one line per request to
+// stdout, or nil when access logging is off.
+func newAccessLog(format string) (*slog.Logger, error) {
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stdout, nil)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stdout, nil)), nil
+	case "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (expected text, json or off)", format)
 	}
 }
 
@@ -48,3 +216,66 @@ func envOr(key, fallback string) string {
 	}
 	return fallback
 }
+
+// parsePrefixes parses a comma-separated list of IP addresses and CIDR
+// ranges. Bare addresses match only themselves.
+func parsePrefixes(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			p, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func envFloat(key string, fallback float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Fatalf("invalid %s %q: %v", key, v, err)
+	}
+	return f
+}
+
+func envInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid %s %q: %v", key, v, err)
+	}
+	return n
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("invalid %s %q: %v", key, v, err)
+	}
+	return d
+}
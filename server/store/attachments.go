@@ -0,0 +1,114 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrHashMismatch is returned by PutAttachment when plaintext data does not
+// hash to the name it was uploaded under.
+var ErrHashMismatch = errors.New("attachment data does not match its hash")
+
+// Attachment is a file referenced from a user's notes. It is addressed by the
+// hex SHA-256 of its plaintext, so uploading the same file twice stores it
+// once.
+type Attachment struct {
+	Hash        string
+	Size        int64
+	ContentType string
+	CreatedAt   string
+	// Encrypted marks data sealed by the client. The server cannot check
+	// its hash or serve it to the web UI.
+	Encrypted bool
+	Data      []byte
+}
+
+// ValidHash reports whether s is a lowercase hex SHA-256, the only form of
+// attachment name accepted.
+func ValidHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// PutAttachment stores data under hash for a user, reporting whether it was
+// new. Plaintext data must hash to hash; data starting with EncryptedPrefix
+// is stored as is. Uploading an existing hash keeps the stored copy.
+func (s *Store) PutAttachment(userID int64, hash, contentType string, data []byte) (a *Attachment, created bool, err error) {
+	encrypted := bytes.HasPrefix(data, []byte(EncryptedPrefix))
+	if !encrypted {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != hash {
+			return nil, false, ErrHashMismatch
+		}
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`
+		INSERT INTO attachments (user_id, hash, size, content_type, encrypted, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, hash) DO NOTHING
+	`, userID, hash, len(data), contentType, encrypted, data, now)
+	if err != nil {
+		return nil, false, fmt.Errorf("put attachment: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, fmt.Errorf("put attachment: %w", err)
+	}
+
+	a, err = s.AttachmentInfo(userID, hash)
+	if err != nil {
+		return nil, false, err
+	}
+	return a, n > 0, nil
+}
+
+// AttachmentInfo returns a user's attachment without its data. Returns nil if
+// not found.
+func (s *Store) AttachmentInfo(userID int64, hash string) (*Attachment, error) {
+	row := s.db.QueryRow(`
+		SELECT hash, size, content_type, encrypted, created_at FROM attachments
+		WHERE user_id = ? AND hash = ?
+	`, userID, hash)
+
+	var a Attachment
+	err := row.Scan(&a.Hash, &a.Size, &a.ContentType, &a.Encrypted, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	return &a, nil
+}
+
+// GetAttachment returns a user's attachment with its data. Returns nil if not
+// found.
+func (s *Store) GetAttachment(userID int64, hash string) (*Attachment, error) {
+	row := s.db.QueryRow(`
+		SELECT hash, size, content_type, encrypted, created_at, data FROM attachments
+		WHERE user_id = ? AND hash = ?
+	`, userID, hash)
+
+	var a Attachment
+	err := row.Scan(&a.Hash, &a.Size, &a.ContentType, &a.Encrypted, &a.CreatedAt, &a.Data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	return &a, nil
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	dailyBackupPrefix  = "scrbl-daily-"
+	weeklyBackupPrefix = "scrbl-weekly-"
+	backupExt          = ".db"
+)
+
+// BackupPolicy controls the backups taken by RunBackups.
+type BackupPolicy struct {
+	// Dir holds the backup files.
+	Dir string
+	// Daily and Weekly are how many backups of each kind to keep. Zero
+	// disables that kind; existing files of it are left alone.
+	Daily  int
+	Weekly int
+}
+
+// Backup writes a consistent copy of the database to path, which must not
+// exist or must be empty. It runs online with VACUUM INTO, so the copy is
+// compacted and readers and writers are not blocked for the duration.
+func (s *Store) Backup(path string) error {
+	if _, err := s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
+
+// RunBackups takes the day's and the ISO week's backup if they do not exist
+// yet, then deletes the oldest backups beyond the policy's limits. It returns
+// the paths of the backups it wrote.
+func (s *Store) RunBackups(p BackupPolicy, now time.Time) ([]string, error) {
+	if err := os.MkdirAll(p.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create backup dir: %w", err)
+	}
+
+	year, week := now.ISOWeek()
+	due := []struct {
+		keep int
+		name string
+	}{
+		{p.Daily, dailyBackupPrefix + now.Format("2006-01-02") + backupExt},
+		{p.Weekly, fmt.Sprintf("%s%d-W%02d%s", weeklyBackupPrefix, year, week, backupExt)},
+	}
+
+	var created []string
+	for _, b := range due {
+		if b.keep <= 0 {
+			continue
+		}
+		path := filepath.Join(p.Dir, b.name)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := s.backupFile(path); err != nil {
+			return created, err
+		}
+		created = append(created, path)
+	}
+
+	if err := pruneBackups(p.Dir, dailyBackupPrefix, p.Daily); err != nil {
+		return created, err
+	}
+	if err := pruneBackups(p.Dir, weeklyBackupPrefix, p.Weekly); err != nil {
+		return created, err
+	}
+	return created, nil
+}
+
+// backupFile writes a backup beside path first, so path only ever holds a
+// complete copy.
+func (s *Store) backupFile(path string) error {
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove stale backup: %w", err)
+	}
+	if err := s.Backup(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
+
+// pruneBackups deletes all but the newest keep backups named with prefix.
+// Names sort by date, so the newest sort last.
+func pruneBackups(dir, prefix string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read backup dir: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, backupExt) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return fmt.Errorf("prune backup: %w", err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
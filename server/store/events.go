@@ -0,0 +1,67 @@
+package store
+
+import gosync "sync"
+
+// changeBuffer is how many changes a slow subscriber may fall behind before
+// further changes to it are dropped.
+const changeBuffer = 64
+
+// Change describes a write to a note, without its content.
+type Change struct {
+	Date      string
+	Revision  int64
+	UpdatedAt string
+	Deleted   bool
+}
+
+// broker fans changes out to per-user subscribers.
+type broker struct {
+	mu   gosync.Mutex
+	subs map[int64]map[chan Change]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{subs: map[int64]map[chan Change]struct{}{}}
+}
+
+// Subscribe returns a channel receiving every change to the user's notes
+// made through this Store, and a function that ends the subscription.
+// Changes are dropped for subscribers that stop reading.
+func (s *Store) Subscribe(userID int64) (<-chan Change, func()) {
+	b := s.events
+	ch := make(chan Change, changeBuffer)
+
+	b.mu.Lock()
+	if b.subs[userID] == nil {
+		b.subs[userID] = map[chan Change]struct{}{}
+	}
+	b.subs[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once gosync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[userID], ch)
+			if len(b.subs[userID]) == 0 {
+				delete(b.subs, userID)
+			}
+			b.mu.Unlock()
+		})
+	}
+}
+
+func (s *Store) publish(userID int64, n *Note) {
+	c := Change{Date: n.Date, Revision: n.Revision, UpdatedAt: n.UpdatedAt, Deleted: n.Deleted}
+
+	b := s.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[userID] {
+		select {
+		case ch <- c:
+		default:
+		}
+	}
+}
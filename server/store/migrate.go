@@ -0,0 +1,288 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew is returned by New when the database was migrated by a
+// newer build than this one, whose schema this build cannot safely use.
+var ErrSchemaTooNew = errors.New("database schema is newer than this server")
+
+// migration is one step of the schema's history. Each runs in its own
+// transaction together with the bump of the recorded version.
+//
+// Released migrations must never change; add a new one to the end instead.
+// Steps are written to also apply cleanly to databases created before
+// versions were recorded, which start at version 0 whatever their shape.
+type migration struct {
+	name string
+	up   func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{"create notes", createNotes},
+	{"add note revisions", addNoteRevisions},
+	{"add users and api keys", addUsers},
+	{"add tombstones", addTombstones},
+	{"add full-text search", migrateSearch},
+	{"add attachments", addAttachments},
+	{"add api key scopes", addKeyScopes},
+	{"add shares", addShares},
+	{"key search index by note id", keySearchIndex},
+	{"add web sessions", addSessions},
+	{"flag encrypted notes", flagEncryptedNotes},
+}
+
+// SchemaVersion is the schema version this build migrates databases to.
+var SchemaVersion = len(migrations)
+
+// migrate brings the database up to SchemaVersion, one migration per
+// transaction. Transactions take the write lock up front, so servers and
+// admin commands starting together do not run a migration twice.
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_version: %w", err)
+	}
+
+	for {
+		done, err := migrateStep(db)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// migrateStep applies the next pending migration, if any, and reports
+// whether the schema is up to date.
+func migrateStep(db *sql.DB) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := schemaVersion(tx)
+	if err != nil {
+		return false, err
+	}
+	if current > len(migrations) {
+		return false, fmt.Errorf("%w: database is at version %d, this build supports up to %d", ErrSchemaTooNew, current, len(migrations))
+	}
+	if current == len(migrations) {
+		return true, nil
+	}
+
+	next := migrations[current]
+	if err := next.up(tx); err != nil {
+		return false, fmt.Errorf("migration %d (%s): %w", current+1, next.name, err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)
+	`, current+1, next.name, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("record migration %d: %w", current+1, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit migration %d: %w", current+1, err)
+	}
+	return false, nil
+}
+
+func schemaVersion(q queryer) (int, error) {
+	var version int
+	err := q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// createNotes is the original single-user schema.
+func createNotes(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS notes (
+		date       TEXT PRIMARY KEY,
+		content    TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_notes_updated ON notes(updated_at);
+	`)
+	return err
+}
+
+// addNoteRevisions numbers every write to a note and keeps each version,
+// seeding history with the current copy of existing notes.
+func addNoteRevisions(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "notes", "revision", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	exists, err := hasTable(tx, "note_revisions")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE TABLE note_revisions (
+		date       TEXT NOT NULL,
+		revision   INTEGER NOT NULL,
+		content    TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		PRIMARY KEY (date, revision)
+	);
+
+	INSERT INTO note_revisions (date, revision, content, created_at)
+	SELECT date, revision, content, updated_at FROM notes;
+	`)
+	return err
+}
+
+// addUsers adds users and their API keys, and rekeys notes and their history
+// by user, giving every existing row to the default user.
+func addUsers(tx *sql.Tx) error {
+	if err := migrateUsers(tx); err != nil {
+		return err
+	}
+
+	scoped, err := hasColumn(tx, "notes", "user_id")
+	if err != nil {
+		return err
+	}
+	if !scoped {
+		rebuild := `
+		CREATE TABLE notes_scoped (
+			user_id    INTEGER NOT NULL REFERENCES users(id),
+			date       TEXT NOT NULL,
+			content    TEXT NOT NULL DEFAULT '',
+			revision   INTEGER NOT NULL DEFAULT 1,
+			created_at TEXT NOT NULL DEFAULT (datetime('now')),
+			updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+			PRIMARY KEY (user_id, date)
+		);
+		INSERT INTO notes_scoped (user_id, date, content, revision, created_at, updated_at)
+		SELECT ?, date, content, revision, created_at, updated_at FROM notes;
+		DROP TABLE notes;
+		ALTER TABLE notes_scoped RENAME TO notes;
+
+		CREATE TABLE note_revisions_scoped (
+			user_id    INTEGER NOT NULL REFERENCES users(id),
+			date       TEXT NOT NULL,
+			revision   INTEGER NOT NULL,
+			content    TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL DEFAULT (datetime('now')),
+			PRIMARY KEY (user_id, date, revision)
+		);
+		INSERT INTO note_revisions_scoped (user_id, date, revision, content, created_at)
+		SELECT ?, date, revision, content, created_at FROM note_revisions;
+		DROP TABLE note_revisions;
+		ALTER TABLE note_revisions_scoped RENAME TO note_revisions;
+		`
+		if _, err := tx.Exec(rebuild, DefaultUserID, DefaultUserID); err != nil {
+			return fmt.Errorf("scope notes: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_notes_updated ON notes(user_id, updated_at)`)
+	return err
+}
+
+// addTombstones lets deleted days be kept as revisions with no content.
+func addTombstones(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "notes", "deleted", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(tx, "note_revisions", "deleted", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// flagEncryptedNotes marks notes holding client-encrypted content, so
+// HasEncryptedNotes can use an index instead of reading every note.
+func flagEncryptedNotes(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "notes", "encrypted", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+	UPDATE notes SET encrypted = 1 WHERE substr(content, 1, ?) = ?;
+	CREATE INDEX IF NOT EXISTS idx_notes_encrypted ON notes(user_id) WHERE encrypted = 1;
+	`, len(EncryptedPrefix), EncryptedPrefix)
+	return err
+}
+
+// addAttachments stores files referenced from notes, addressed by the
+// SHA-256 of their plaintext.
+func addAttachments(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS attachments (
+		user_id      INTEGER NOT NULL REFERENCES users(id),
+		hash         TEXT NOT NULL,
+		size         INTEGER NOT NULL,
+		content_type TEXT NOT NULL DEFAULT 'application/octet-stream',
+		encrypted    INTEGER NOT NULL DEFAULT 0,
+		data         BLOB NOT NULL,
+		created_at   TEXT NOT NULL DEFAULT (datetime('now')),
+		PRIMARY KEY (user_id, hash)
+	)
+	`)
+	return err
+}
+
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	found, err := hasColumn(tx, table, column)
+	if err != nil || found {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func hasTable(q queryer, table string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)
+	`, table).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("check %s table: %w", table, err)
+	}
+	return exists, nil
+}
+
+func hasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, fmt.Errorf("scan: %w", err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -0,0 +1,284 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// baselineDB creates a database with the first release's schema and data.
+func baselineDB(t *testing.T) string {
+	t.Helper()
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "baseline.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "scrbl.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(string(fixture)); err != nil {
+		t.Fatalf("load fixture: %v", err)
+	}
+	return path
+}
+
+func openStore(t *testing.T, path string) *Store {
+	t.Helper()
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func appliedVersions(t *testing.T, s *Store) []int {
+	t.Helper()
+
+	rows, err := s.db.Query(`SELECT version FROM schema_version ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return versions
+}
+
+func TestMigrateFromBaseline(t *testing.T) {
+	s := openStore(t, baselineDB(t))
+
+	want := make([]int, SchemaVersion)
+	for i := range want {
+		want[i] = i + 1
+	}
+	if got := appliedVersions(t, s); !slices.Equal(got, want) {
+		t.Fatalf("applied versions = %v, want %v", got, want)
+	}
+
+	dates, err := s.ListDates(DefaultUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2025-02-03", "2025-01-29", "2025-01-28"}; !slices.Equal(dates, want) {
+		t.Fatalf("dates = %v, want %v", dates, want)
+	}
+
+	note, err := s.Get(DefaultUserID, "2025-01-29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note == nil || note.Revision != 1 || note.UpdatedAt != "2025-01-29T16:40:00Z" || note.Deleted {
+		t.Fatalf("migrated note = %+v", note)
+	}
+
+	revs, err := s.ListRevisions(DefaultUserID, "2025-01-29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 1 || revs[0].Revision != 1 {
+		t.Fatalf("revisions = %+v, want the seeded revision 1", revs)
+	}
+
+	results, err := s.Search(DefaultUserID, SearchQuery{Text: "migration*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("search found %d notes, want 2", len(results))
+	}
+
+	// The upgraded schema takes writes like a fresh one.
+	if _, conflict, err := s.Upsert(DefaultUserID, "2025-01-29", "edited\n", 1); err != nil || conflict {
+		t.Fatalf("Upsert: conflict=%v err=%v", conflict, err)
+	}
+	if _, conflict, err := s.Delete(DefaultUserID, "2025-01-28", 1); err != nil || conflict {
+		t.Fatalf("Delete: conflict=%v err=%v", conflict, err)
+	}
+	bob, err := s.CreateUser("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Upsert(bob.ID, "2025-01-29", "edited by bob\n", AnyRevision); err != nil {
+		t.Fatal(err)
+	}
+
+	// The search index follows the writes, and each user's own note only.
+	for text, want := range map[string]int{"migration*": 0, "edited": 1} {
+		results, err := s.Search(DefaultUserID, SearchQuery{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != want {
+			t.Errorf("search for %s after writes found %d notes, want %d", text, len(results), want)
+		}
+	}
+	var indexed, notes int
+	if err := s.db.QueryRow(`SELECT (SELECT COUNT(*) FROM notes_fts), (SELECT COUNT(*) FROM notes)`).Scan(&indexed, &notes); err != nil {
+		t.Fatal(err)
+	}
+	if indexed != notes {
+		t.Errorf("notes_fts has %d rows, want one per note (%d)", indexed, notes)
+	}
+	key, err := s.CreateAPIKey(DefaultUserID, []string{ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, scopes, err := s.UserForKey(key); err != nil || user == nil || user.ID != DefaultUserID || !slices.Equal(scopes, []string{ScopeRead}) {
+		t.Fatalf("UserForKey = %+v, %v, %v", user, scopes, err)
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	path := baselineDB(t)
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = openStore(t, path)
+	if got := appliedVersions(t, s); len(got) != SchemaVersion {
+		t.Fatalf("reopening applied versions %v", got)
+	}
+}
+
+func TestMigrateFreshMatchesUpgraded(t *testing.T) {
+	fresh := openStore(t, filepath.Join(t.TempDir(), "fresh.db"))
+	upgraded := openStore(t, baselineDB(t))
+
+	for _, table := range []string{"notes", "note_revisions", "users", "api_keys", "notes_fts", "notes_fts_map", "attachments", "shares", "sessions"} {
+		a, b := columns(t, fresh, table), columns(t, upgraded, table)
+		if !slices.Equal(a, b) {
+			t.Errorf("%s columns: fresh %v, upgraded %v", table, a, b)
+		}
+	}
+}
+
+func columns(t *testing.T, s *Store, table string) []string {
+	t.Helper()
+
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		t.Fatalf("table %s is missing", table)
+	}
+	return names
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scrbl.db")
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.db.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'from the future', '')`, SchemaVersion+1)
+	s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := New(path); !errors.Is(err, ErrSchemaTooNew) {
+		if s != nil {
+			s.Close()
+		}
+		t.Fatalf("New on a newer schema: err = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrationFailureRollsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scrbl.db")
+	openStore(t, path).Close()
+
+	failing := migration{"half done", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`CREATE TABLE half_done (id INTEGER)`); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	}}
+	saved := migrations
+	migrations = append(slices.Clip(saved), failing)
+	defer func() { migrations = saved }()
+
+	if _, err := New(path); err == nil {
+		t.Fatal("New succeeded despite a failing migration")
+	}
+
+	migrations = saved
+	s := openStore(t, path)
+	if got := appliedVersions(t, s); len(got) != SchemaVersion {
+		t.Fatalf("applied versions = %v after a failed migration", got)
+	}
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE name = 'half_done')`).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("failed migration left its table behind")
+	}
+}
+
+func TestMigrateKeepsKeyAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scrbl.db")
+
+	// A database from before scopes, with keys for two users.
+	saved := migrations
+	migrations = slices.Clip(saved[:slices.IndexFunc(saved, func(m migration) bool { return m.name == "add api key scopes" })])
+	s, err := New(path)
+	migrations = saved
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO users (id, name) VALUES (2, 'bob');
+		INSERT INTO api_keys (user_id, key_hash) VALUES (1, ?), (2, ?);
+	`, HashKey("scrbl_owner_key"), HashKey("scrbl_bob_key"))
+	s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s = openStore(t, path)
+	for key, want := range map[string][]string{
+		"scrbl_owner_key": {ScopeRead, ScopeWrite, ScopeAdmin},
+		"scrbl_bob_key":   {ScopeRead, ScopeWrite},
+	} {
+		if _, scopes, err := s.UserForKey(key); err != nil || !slices.Equal(scopes, want) {
+			t.Errorf("UserForKey(%s) scopes = %v, %v, want %v", key, scopes, err, want)
+		}
+	}
+}
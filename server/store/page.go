@@ -0,0 +1,81 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not issued by the same
+// kind of listing.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// MaxPageLimit is the largest page a listing returns.
+const MaxPageLimit = 1000
+
+// Page selects part of a listing. The zero value selects all of it.
+type Page struct {
+	// Limit is the most items to return; 0 means no limit. Larger values
+	// are capped at MaxPageLimit.
+	Limit int
+	// Cursor is the next cursor returned with the previous page, or empty
+	// for the first page.
+	Cursor string
+}
+
+// Cursor kinds.
+const (
+	cursorDates  = "dates"
+	cursorNotes  = "notes"
+	cursorSince  = "since"
+	cursorSearch = "search"
+)
+
+// cursor is the decoded form of a page cursor. Listings ordered by date
+// resume after Date; search results, ordered by rank, resume at Offset.
+type cursor struct {
+	Kind   string `json:"k"`
+	Date   string `json:"d,omitempty"`
+	Offset int    `json:"o,omitempty"`
+}
+
+func (c cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parseCursor decodes p.Cursor for a listing of the given kind. An empty
+// cursor decodes to the start of the listing.
+func (p Page) parseCursor(kind string) (cursor, error) {
+	if p.Cursor == "" {
+		return cursor{Kind: kind}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Kind != kind || c.Offset < 0 {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// sqlLimit is the LIMIT for a page query. It asks for one row more than the
+// page holds, to tell whether another page follows; -1 means no limit.
+func (p Page) sqlLimit() int {
+	if p.Limit <= 0 {
+		return -1
+	}
+	return min(p.Limit, MaxPageLimit) + 1
+}
+
+// trim cuts items fetched with sqlLimit down to the page and reports whether
+// another page follows.
+func trim[T any](p Page, items []T) ([]T, bool) {
+	if p.Limit <= 0 || len(items) <= min(p.Limit, MaxPageLimit) {
+		return items, false
+	}
+	return items[:min(p.Limit, MaxPageLimit)], true
+}
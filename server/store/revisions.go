@@ -0,0 +1,122 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Revision is a historical version of a day's note. Every Upsert and Delete
+// records one.
+//
+// Revisions are never pruned. Each holds a full copy of the note, so a
+// day's history grows by the note's size on every save. For a text journal
+// that stays small; Stats reports the database size to watch it.
+type Revision struct {
+	Date      string
+	Revision  int64
+	Content   string
+	Size      int
+	CreatedAt string
+	Deleted   bool
+}
+
+func insertRevision(tx *sql.Tx, userID int64, n *Note) error {
+	_, err := tx.Exec(`
+		INSERT INTO note_revisions (user_id, date, revision, content, deleted, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, n.Date, n.Revision, n.Content, n.Deleted, n.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("insert revision: %w", err)
+	}
+	return nil
+}
+
+// ListRevisions returns the history of a user's note for a day without
+// content, newest first.
+func (s *Store) ListRevisions(userID int64, date string) ([]Revision, error) {
+	rows, err := s.db.Query(`
+		SELECT date, revision, length(CAST(content AS BLOB)), deleted, created_at FROM note_revisions
+		WHERE user_id = ? AND date = ?
+		ORDER BY revision DESC
+	`, userID, date)
+	if err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revs []Revision
+	for rows.Next() {
+		var r Revision
+		if err := rows.Scan(&r.Date, &r.Revision, &r.Size, &r.Deleted, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		revs = append(revs, r)
+	}
+
+	return revs, rows.Err()
+}
+
+// GetRevision retrieves one historical version of a note. Returns nil if not
+// found.
+func (s *Store) GetRevision(userID int64, date string, revision int64) (*Revision, error) {
+	return getRevision(s.db, userID, date, revision)
+}
+
+func getRevision(q queryer, userID int64, date string, revision int64) (*Revision, error) {
+	row := q.QueryRow(`
+		SELECT date, revision, content, deleted, created_at FROM note_revisions
+		WHERE user_id = ? AND date = ? AND revision = ?
+	`, userID, date, revision)
+
+	var r Revision
+	err := row.Scan(&r.Date, &r.Revision, &r.Content, &r.Deleted, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get revision: %w", err)
+	}
+	r.Size = len(r.Content)
+
+	return &r, nil
+}
+
+// Restore writes the content of an older revision as a new revision of the
+// note, so the restore itself is part of the history. Restoring a tombstone
+// deletes the day again, or returns the day unchanged if it is deleted
+// already. Returns nil if the revision does not exist. The revision is
+// read and written in one transaction, so a concurrent write lands either
+// before the restore or after it, never in between.
+func (s *Store) Restore(userID int64, date string, revision int64) (*Note, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	defer tx.Rollback()
+
+	r, err := getRevision(tx, userID, date, revision)
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	var note *Note
+	written := true
+	if r.Deleted {
+		note, written, _, err = deleteNote(tx, userID, date, AnyRevision)
+	} else {
+		note, _, err = upsertNote(tx, userID, date, r.Content, AnyRevision)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	if !written {
+		return note, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("restore commit: %w", err)
+	}
+
+	s.publish(userID, note)
+	return note, nil
+}
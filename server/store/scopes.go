@@ -0,0 +1,84 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// Scopes an API key may be granted.
+const (
+	ScopeRead  = apiv1.ScopeRead
+	ScopeWrite = apiv1.ScopeWrite
+	ScopeAdmin = apiv1.ScopeAdmin
+)
+
+// AllScopes lists every scope in canonical order.
+var AllScopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// DefaultScopes are granted to new keys unless others are asked for. Admin
+// reaches every user's notes through backups, so it is never implied.
+var DefaultScopes = []string{ScopeRead, ScopeWrite}
+
+// ErrInvalidScope is returned for unknown or empty scope lists.
+var ErrInvalidScope = errors.New("invalid scope")
+
+// ParseScopes parses a comma-separated list such as "read,write" into
+// canonical order.
+func ParseScopes(list string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !slices.Contains(AllScopes, s) {
+			return nil, fmt.Errorf("%w %q, expected %s", ErrInvalidScope, s, strings.Join(AllScopes, ", "))
+		}
+		scopes = append(scopes, s)
+	}
+	return normalizeScopes(scopes)
+}
+
+// normalizeScopes checks scopes and returns them deduplicated in canonical
+// order.
+func normalizeScopes(scopes []string) ([]string, error) {
+	var out []string
+	for _, s := range AllScopes {
+		if slices.Contains(scopes, s) {
+			out = append(out, s)
+		}
+	}
+	for _, s := range scopes {
+		if !slices.Contains(AllScopes, s) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidScope, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	return out, nil
+}
+
+// splitScopes reads the stored form of a key's scopes.
+func splitScopes(stored string) []string {
+	if stored == "" {
+		return nil
+	}
+	return strings.Split(stored, ",")
+}
+
+// addKeyScopes limits what each API key may do. Existing keys keep the
+// access they had: every key could read and write, and the default user's
+// keys could also download backups.
+func addKeyScopes(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "api_keys", "scopes", "TEXT NOT NULL DEFAULT 'read,write'"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE api_keys SET scopes = 'read,write,admin' WHERE user_id = ?`, DefaultUserID)
+	return err
+}
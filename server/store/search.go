@@ -0,0 +1,277 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrInvalidQuery is returned by Search when the query is not valid FTS5
+// syntax.
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// SearchLimit is how many results Search returns.
+const SearchLimit = 50
+
+const (
+	// Snippets mark matches with <mark> tags. highlight() uses bytes that
+	// never occur in UTF-8 instead, so match offsets can be recovered
+	// exactly whatever the note contains. Notes arrive as JSON and are
+	// always valid UTF-8.
+	snippetOpen   = "<mark>"
+	snippetClose  = "</mark>"
+	offsetOpen    = "\xfe"
+	offsetClose   = "\xff"
+	snippetTokens = 16
+)
+
+// SearchQuery selects notes for Search. Text uses FTS5 query syntax: bare
+// words are ANDed, "quoted phrases", prefix* terms and AND/OR/NOT are
+// supported. From and To are optional inclusive YYYY-MM-DD bounds.
+type SearchQuery struct {
+	Text string
+	From string
+	To   string
+}
+
+// SearchResult is one matching note, without its full content.
+type SearchResult struct {
+	Date      string
+	Snippet   string
+	Matches   []Span
+	Score     float64
+	UpdatedAt string
+}
+
+// Span is a matched byte range [Start, End) in a note's content.
+type Span struct {
+	Start int
+	End   int
+}
+
+// migrateSearch creates the full-text index and the triggers that keep it in
+// step with the notes table, indexing existing notes the first time.
+func migrateSearch(tx *sql.Tx) error {
+	exists, err := hasTable(tx, "notes_fts")
+	if err != nil {
+		return err
+	}
+
+	// Indexes built before notes were scoped by user are rebuilt from
+	// scratch; FTS5 tables cannot gain columns.
+	if exists {
+		scoped, err := hasColumn(tx, "notes_fts", "user_id")
+		if err != nil {
+			return err
+		}
+		if !scoped {
+			drop := `
+			DROP TRIGGER IF EXISTS notes_fts_insert;
+			DROP TRIGGER IF EXISTS notes_fts_update;
+			DROP TRIGGER IF EXISTS notes_fts_delete;
+			DROP TABLE notes_fts;
+			`
+			if _, err := tx.Exec(drop); err != nil {
+				return fmt.Errorf("drop search index: %w", err)
+			}
+			exists = false
+		}
+	}
+
+	// user_id and date are stored rather than joined through rowid because
+	// notes has no INTEGER PRIMARY KEY, so its rowids may change on VACUUM.
+	schema := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(
+		user_id UNINDEXED,
+		date UNINDEXED,
+		content,
+		tokenize = 'unicode61'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS notes_fts_insert AFTER INSERT ON notes BEGIN
+		INSERT INTO notes_fts (user_id, date, content) VALUES (new.user_id, new.date, new.content);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS notes_fts_update AFTER UPDATE OF content ON notes BEGIN
+		DELETE FROM notes_fts WHERE user_id = old.user_id AND date = old.date;
+		INSERT INTO notes_fts (user_id, date, content) VALUES (new.user_id, new.date, new.content);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS notes_fts_delete AFTER DELETE ON notes BEGIN
+		DELETE FROM notes_fts WHERE user_id = old.user_id AND date = old.date;
+	END;
+	`
+	if _, err := tx.Exec(schema); err != nil {
+		return fmt.Errorf("create search index: %w", err)
+	}
+
+	if !exists {
+		if _, err := tx.Exec(`INSERT INTO notes_fts (user_id, date, content) SELECT user_id, date, content FROM notes`); err != nil {
+			return fmt.Errorf("build search index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// keySearchIndex gives every note a stable integer id in notes_fts_map and
+// uses it as the notes_fts rowid, so the triggers update one index row by
+// rowid instead of scanning the UNINDEXED user_id and date columns of every
+// user's notes. The index is rebuilt once.
+func keySearchIndex(tx *sql.Tx) error {
+	schema := `
+	DROP TRIGGER IF EXISTS notes_fts_insert;
+	DROP TRIGGER IF EXISTS notes_fts_update;
+	DROP TRIGGER IF EXISTS notes_fts_delete;
+	DROP TABLE IF EXISTS notes_fts;
+
+	CREATE TABLE IF NOT EXISTS notes_fts_map (
+		id      INTEGER PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		date    TEXT NOT NULL,
+		UNIQUE (user_id, date)
+	);
+
+	CREATE VIRTUAL TABLE notes_fts USING fts5(
+		user_id UNINDEXED,
+		date UNINDEXED,
+		content,
+		tokenize = 'unicode61'
+	);
+
+	CREATE TRIGGER notes_fts_insert AFTER INSERT ON notes BEGIN
+		INSERT OR IGNORE INTO notes_fts_map (user_id, date) VALUES (new.user_id, new.date);
+		INSERT INTO notes_fts (rowid, user_id, date, content) VALUES (
+			(SELECT id FROM notes_fts_map WHERE user_id = new.user_id AND date = new.date),
+			new.user_id, new.date, new.content);
+	END;
+
+	CREATE TRIGGER notes_fts_update AFTER UPDATE OF content ON notes BEGIN
+		DELETE FROM notes_fts WHERE rowid = (SELECT id FROM notes_fts_map WHERE user_id = old.user_id AND date = old.date);
+		INSERT INTO notes_fts (rowid, user_id, date, content) VALUES (
+			(SELECT id FROM notes_fts_map WHERE user_id = new.user_id AND date = new.date),
+			new.user_id, new.date, new.content);
+	END;
+
+	CREATE TRIGGER notes_fts_delete AFTER DELETE ON notes BEGIN
+		DELETE FROM notes_fts WHERE rowid = (SELECT id FROM notes_fts_map WHERE user_id = old.user_id AND date = old.date);
+		DELETE FROM notes_fts_map WHERE user_id = old.user_id AND date = old.date;
+	END;
+
+	INSERT OR IGNORE INTO notes_fts_map (user_id, date) SELECT user_id, date FROM notes;
+	INSERT INTO notes_fts (rowid, user_id, date, content)
+		SELECT m.id, n.user_id, n.date, n.content
+		FROM notes n JOIN notes_fts_map m ON m.user_id = n.user_id AND m.date = n.date;
+	`
+	if _, err := tx.Exec(schema); err != nil {
+		return fmt.Errorf("key search index: %w", err)
+	}
+	return nil
+}
+
+// Search runs a full-text query over a user's notes and returns up to 50
+// notes ranked by bm25, best first. Score is the negated bm25 rank, so higher
+// is better.
+func (s *Store) Search(userID int64, q SearchQuery) ([]SearchResult, error) {
+	results, _, err := s.SearchPage(userID, q, Page{Limit: SearchLimit})
+	return results, err
+}
+
+// SearchPage is Search one page at a time, returning the cursor of the next
+// page, empty after the last. Pages are ranked afresh on every call, so
+// writes between calls can shift results across pages.
+func (s *Store) SearchPage(userID int64, q SearchQuery, p Page) ([]SearchResult, string, error) {
+	c, err := p.parseCursor(cursorSearch)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where := []string{"notes_fts MATCH ?", "f.user_id = ?", "n.deleted = 0"}
+	args := []any{snippetOpen, snippetClose, snippetTokens, offsetOpen, offsetClose, q.Text, userID}
+	if q.From != "" {
+		where = append(where, "f.date >= ?")
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		where = append(where, "f.date <= ?")
+		args = append(args, q.To)
+	}
+	args = append(args, p.sqlLimit(), c.Offset)
+
+	rows, err := s.db.Query(`
+		SELECT f.date,
+		       snippet(notes_fts, 2, ?, ?, '…', ?),
+		       highlight(notes_fts, 2, ?, ?),
+		       -bm25(notes_fts),
+		       n.updated_at
+		FROM notes_fts f
+		JOIN notes n ON n.user_id = f.user_id AND n.date = f.date
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY bm25(notes_fts), f.date DESC
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		return nil, "", searchError(err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var highlighted string
+		if err := rows.Scan(&r.Date, &r.Snippet, &highlighted, &r.Score, &r.UpdatedAt); err != nil {
+			return nil, "", fmt.Errorf("scan: %w", err)
+		}
+		r.Matches = matchSpans(highlighted)
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", searchError(err)
+	}
+
+	results, more := trim(p, results)
+	if !more {
+		return results, "", nil
+	}
+	return results, cursor{Kind: cursorSearch, Offset: c.Offset + len(results)}.String(), nil
+}
+
+// searchError maps FTS5 syntax errors to ErrInvalidQuery. The statement
+// itself is fixed, so a generic SQLITE_ERROR can only come from the MATCH
+// expression.
+func searchError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_ERROR {
+		return fmt.Errorf("%w: %s", ErrInvalidQuery, strings.TrimPrefix(sqliteErr.Error(), "SQL logic error: "))
+	}
+	return fmt.Errorf("search: %w", err)
+}
+
+// matchSpans recovers match offsets in the original content from text
+// produced by highlight() with the offset markers.
+func matchSpans(highlighted string) []Span {
+	spans := []Span{}
+	pos := 0
+	start := -1
+
+	for i := 0; i < len(highlighted); i++ {
+		switch highlighted[i] {
+		case offsetOpen[0]:
+			start = pos
+		case offsetClose[0]:
+			if start >= 0 {
+				spans = append(spans, Span{Start: start, End: pos})
+				start = -1
+			}
+		default:
+			pos++
+		}
+	}
+
+	return spans
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// addSessions stores web UI sessions. A session keeps the hash of the API
+// key it was opened with, so revoking or changing the key ends it, and the
+// key itself never goes back to the browser.
+func addSessions(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS sessions (
+		id         INTEGER PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		key_hash   TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL
+	)
+	`)
+	return err
+}
+
+// CreateSession opens a session for an API key that lasts ttl and returns
+// its token. Expired sessions are removed on the way.
+func (s *Store) CreateSession(key string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate session: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	now := time.Now().UTC()
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, now.Format(time.RFC3339)); err != nil {
+		return "", fmt.Errorf("create session: %w", err)
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO sessions (token_hash, key_hash, created_at, expires_at) VALUES (?, ?, ?, ?)
+	`, HashKey(token), HashKey(key), now.Format(time.RFC3339), now.Add(ttl).Format(time.RFC3339))
+	if err != nil {
+		return "", fmt.Errorf("create session: %w", err)
+	}
+	return token, nil
+}
+
+// SessionKeyHash returns the HashKey of the API key a session was opened
+// with, or "" if the token is unknown or expired.
+func (s *Store) SessionKeyHash(token string) (string, error) {
+	var hash string
+	err := s.db.QueryRow(`
+		SELECT key_hash FROM sessions WHERE token_hash = ? AND expires_at > ?
+	`, HashKey(token), time.Now().UTC().Format(time.RFC3339)).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get session: %w", err)
+	}
+	return hash, nil
+}
+
+// DeleteSession ends a session. Unknown tokens are ignored.
+func (s *Store) DeleteSession(token string) error {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, HashKey(token)); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
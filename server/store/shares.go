@@ -0,0 +1,112 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrShareNotFound is returned by RevokeShare for an unknown token.
+var ErrShareNotFound = errors.New("share not found")
+
+// Share is a public link to one day of a user's notebook. Like API keys,
+// share tokens are stored as hashes, so they are only known when created.
+type Share struct {
+	ID        int64
+	UserID    int64
+	Date      string
+	CreatedAt string
+	// ExpiresAt is empty for links that work until revoked.
+	ExpiresAt string
+}
+
+// Expired reports whether the link stopped working before now.
+func (sh *Share) Expired(now time.Time) bool {
+	if sh.ExpiresAt == "" {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, sh.ExpiresAt)
+	return err != nil || !now.Before(expires)
+}
+
+// addShares stores public links to single days.
+func addShares(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS shares (
+		id         INTEGER PRIMARY KEY,
+		user_id    INTEGER NOT NULL REFERENCES users(id),
+		date       TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at TEXT NOT NULL,
+		expires_at TEXT
+	)
+	`)
+	return err
+}
+
+// CreateShare makes a link to a user's note for date and returns its token.
+// A zero expiresAt makes a link that works until revoked.
+func (s *Store) CreateShare(userID int64, date string, expiresAt time.Time) (string, *Share, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("generate share token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	sh := &Share{UserID: userID, Date: date, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	var expires sql.NullString
+	if !expiresAt.IsZero() {
+		sh.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+		expires = sql.NullString{String: sh.ExpiresAt, Valid: true}
+	}
+
+	res, err := s.db.Exec(`
+		INSERT INTO shares (user_id, date, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?)
+	`, userID, date, HashKey(token), sh.CreatedAt, expires)
+	if err != nil {
+		return "", nil, fmt.Errorf("create share: %w", err)
+	}
+	if sh.ID, err = res.LastInsertId(); err != nil {
+		return "", nil, fmt.Errorf("create share: %w", err)
+	}
+	return token, sh, nil
+}
+
+// ShareForToken looks up a link, expired or not. Returns nil if the token is
+// unknown or was revoked.
+func (s *Store) ShareForToken(token string) (*Share, error) {
+	row := s.db.QueryRow(`
+		SELECT id, user_id, date, created_at, COALESCE(expires_at, '')
+		FROM shares WHERE token_hash = ?
+	`, HashKey(token))
+
+	var sh Share
+	err := row.Scan(&sh.ID, &sh.UserID, &sh.Date, &sh.CreatedAt, &sh.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get share: %w", err)
+	}
+	return &sh, nil
+}
+
+// RevokeShare deletes one of a user's links, expired or not.
+func (s *Store) RevokeShare(userID int64, token string) error {
+	res, err := s.db.Exec(`DELETE FROM shares WHERE user_id = ? AND token_hash = ?`, userID, HashKey(token))
+	if err != nil {
+		return fmt.Errorf("revoke share: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("revoke share: %w", err)
+	}
+	if n == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
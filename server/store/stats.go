@@ -0,0 +1,36 @@
+package store
+
+import "fmt"
+
+// Stats summarises the database for monitoring.
+type Stats struct {
+	Users       int64
+	Notes       int64
+	Tombstones  int64
+	Revisions   int64
+	Attachments int64
+	// AttachmentBytes is the stored size of all attachments, which is
+	// also part of DBSizeBytes.
+	AttachmentBytes int64
+	DBSizeBytes     int64
+}
+
+// Stats counts users, notes, revisions and attachments across all users
+// and reports the size of the main database file.
+func (s *Store) Stats() (Stats, error) {
+	var st Stats
+	err := s.db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM notes WHERE deleted = 0),
+			(SELECT COUNT(*) FROM notes WHERE deleted = 1),
+			(SELECT COUNT(*) FROM note_revisions),
+			(SELECT COUNT(*) FROM attachments),
+			(SELECT COALESCE(SUM(size), 0) FROM attachments),
+			(SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size())
+	`).Scan(&st.Users, &st.Notes, &st.Tombstones, &st.Revisions, &st.Attachments, &st.AttachmentBytes, &st.DBSizeBytes)
+	if err != nil {
+		return Stats{}, fmt.Errorf("stats: %w", err)
+	}
+	return st, nil
+}
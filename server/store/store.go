@@ -3,26 +3,41 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/juliuswalton/scrbl-server/apiv1"
 	_ "modernc.org/sqlite"
 )
 
 // Store wraps a SQLite database for note storage.
 type Store struct {
-	db *sql.DB
+	db     *sql.DB
+	events *broker
 }
 
 // Note represents a single day's note.
 type Note struct {
-	Date      string `json:"date"`
-	Content   string `json:"content"`
-	UpdatedAt string `json:"updated_at"`
+	Date      string
+	Content   string
+	Revision  int64
+	UpdatedAt string
+	// Deleted marks a tombstone: the day was deleted at this revision and
+	// Content is empty.
+	Deleted bool
 }
 
+// EncryptedPrefix marks content encrypted by the client before upload. The
+// server never decrypts it; it only needs to know that such notes exist.
+const EncryptedPrefix = apiv1.EncryptedPrefix
+
+// AnyRevision can be passed to Upsert to skip the revision check and
+// overwrite whatever is currently stored.
+const AnyRevision int64 = -1
+
 // New opens (or creates) the SQLite database and runs migrations.
 func New(dbPath string) (*Store, error) {
-	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
@@ -32,7 +47,7 @@ func New(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("migrate: %w", err)
 	}
 
-	return &Store{db: db}, nil
+	return &Store{db: db, events: newBroker()}, nil
 }
 
 // Close closes the database.
@@ -40,46 +55,149 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
-func migrate(db *sql.DB) error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS notes (
-		date       TEXT PRIMARY KEY,
-		content    TEXT NOT NULL DEFAULT '',
-		created_at TEXT NOT NULL DEFAULT (datetime('now')),
-		updated_at TEXT NOT NULL DEFAULT (datetime('now'))
-	);
+// Upsert creates or updates a user's note for a given date. Writing to a
+// deleted day brings it back.
+//
+// baseRevision is the revision the caller last saw (0 if it has never seen
+// the note). If the stored revision differs, nothing is written and the
+// current note is returned with conflict set to true. Pass AnyRevision to
+// overwrite unconditionally.
+func (s *Store) Upsert(userID int64, date, content string, baseRevision int64) (note *Note, conflict bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("upsert: %w", err)
+	}
+	defer tx.Rollback()
 
-	CREATE INDEX IF NOT EXISTS idx_notes_updated ON notes(updated_at);
-	`
-	_, err := db.Exec(schema)
-	return err
+	note, conflict, err = upsertNote(tx, userID, date, content, baseRevision)
+	if err != nil || conflict {
+		return note, conflict, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("upsert commit: %w", err)
+	}
+
+	s.publish(userID, note)
+	return note, false, nil
 }
 
-// Upsert creates or updates a note for a given date.
-// Returns the updated note and whether a conflict was detected.
-func (s *Store) Upsert(date, content string) (*Note, error) {
+// upsertNote is Upsert within tx. Unless there is a conflict, the caller
+// commits and publishes the returned note.
+func upsertNote(tx *sql.Tx, userID int64, date, content string, baseRevision int64) (*Note, bool, error) {
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	_, err := s.db.Exec(`
-		INSERT INTO notes (date, content, created_at, updated_at)
-		VALUES (?, ?, ?, ?)
-		ON CONFLICT(date) DO UPDATE SET
+	current, err := getNote(tx, userID, date)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var currentRevision int64
+	if current != nil {
+		currentRevision = current.Revision
+	}
+	if baseRevision != AnyRevision && baseRevision != currentRevision {
+		if current == nil {
+			current = &Note{Date: date}
+		}
+		return current, true, nil
+	}
+
+	next := &Note{Date: date, Content: content, Revision: currentRevision + 1, UpdatedAt: now}
+	_, err = tx.Exec(`
+		INSERT INTO notes (user_id, date, content, revision, encrypted, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, date) DO UPDATE SET
 			content = excluded.content,
+			revision = excluded.revision,
+			deleted = 0,
+			encrypted = excluded.encrypted,
 			updated_at = excluded.updated_at
-	`, date, content, now, now)
+	`, userID, next.Date, next.Content, next.Revision, strings.HasPrefix(content, EncryptedPrefix), now, now)
+	if err != nil {
+		return nil, false, fmt.Errorf("upsert: %w", err)
+	}
+
+	if err := insertRevision(tx, userID, next); err != nil {
+		return nil, false, err
+	}
+	return next, false, nil
+}
+
+// Delete replaces a user's note with a tombstone, so the deletion reaches
+// other clients through GetUpdatedSince and stays in the history. The
+// revision check works as in Upsert. Deleting a missing day returns nil;
+// deleting a tombstone returns it unchanged.
+func (s *Store) Delete(userID int64, date string, baseRevision int64) (note *Note, conflict bool, err error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("upsert: %w", err)
+		return nil, false, fmt.Errorf("delete: %w", err)
+	}
+	defer tx.Rollback()
+
+	note, written, conflict, err := deleteNote(tx, userID, date, baseRevision)
+	if err != nil || !written {
+		return note, conflict, err
 	}
 
-	return &Note{Date: date, Content: content, UpdatedAt: now}, nil
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("delete commit: %w", err)
+	}
+
+	s.publish(userID, note)
+	return note, false, nil
 }
 
-// Get retrieves a note by date. Returns nil if not found.
-func (s *Store) Get(date string) (*Note, error) {
-	row := s.db.QueryRow(`SELECT date, content, updated_at FROM notes WHERE date = ?`, date)
+// deleteNote is Delete within tx. When it reports a tombstone written, the
+// caller commits and publishes it.
+func deleteNote(tx *sql.Tx, userID int64, date string, baseRevision int64) (note *Note, written, conflict bool, err error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	current, err := getNote(tx, userID, date)
+	if err != nil || current == nil {
+		return nil, false, false, err
+	}
+	if baseRevision != AnyRevision && baseRevision != current.Revision {
+		return current, false, true, nil
+	}
+	if current.Deleted {
+		return current, false, false, nil
+	}
+
+	tombstone := &Note{Date: date, Revision: current.Revision + 1, UpdatedAt: now, Deleted: true}
+	_, err = tx.Exec(`
+		UPDATE notes SET content = '', revision = ?, deleted = 1, encrypted = 0, updated_at = ?
+		WHERE user_id = ? AND date = ?
+	`, tombstone.Revision, now, userID, date)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("delete: %w", err)
+	}
+
+	if err := insertRevision(tx, userID, tombstone); err != nil {
+		return nil, false, false, err
+	}
+	return tombstone, true, false, nil
+}
+
+// Get retrieves a user's note by date, including tombstones. Returns nil if
+// not found.
+func (s *Store) Get(userID int64, date string) (*Note, error) {
+	return getNote(s.db, userID, date)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func getNote(q queryer, userID int64, date string) (*Note, error) {
+	row := q.QueryRow(`
+		SELECT date, content, revision, deleted, updated_at FROM notes
+		WHERE user_id = ? AND date = ?
+	`, userID, date)
 
 	var n Note
-	err := row.Scan(&n.Date, &n.Content, &n.UpdatedAt)
+	err := row.Scan(&n.Date, &n.Content, &n.Revision, &n.Deleted, &n.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -90,11 +208,28 @@ func (s *Store) Get(date string) (*Note, error) {
 	return &n, nil
 }
 
-// ListDates returns all note dates, most recent first.
-func (s *Store) ListDates() ([]string, error) {
-	rows, err := s.db.Query(`SELECT date FROM notes ORDER BY date DESC`)
+// ListDates returns all of a user's note dates, most recent first.
+func (s *Store) ListDates(userID int64) ([]string, error) {
+	dates, _, err := s.ListDatesPage(userID, Page{})
+	return dates, err
+}
+
+// ListDatesPage returns a page of a user's note dates, most recent first,
+// and the cursor of the next page, empty after the last.
+func (s *Store) ListDatesPage(userID int64, p Page) ([]string, string, error) {
+	c, err := p.parseCursor(cursorDates)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT date FROM notes
+		WHERE user_id = ? AND deleted = 0 AND (? = '' OR date < ?)
+		ORDER BY date DESC
+		LIMIT ?
+	`, userID, c.Date, c.Date, p.sqlLimit())
 	if err != nil {
-		return nil, fmt.Errorf("list: %w", err)
+		return nil, "", fmt.Errorf("list: %w", err)
 	}
 	defer rows.Close()
 
@@ -102,61 +237,111 @@ func (s *Store) ListDates() ([]string, error) {
 	for rows.Next() {
 		var d string
 		if err := rows.Scan(&d); err != nil {
-			return nil, fmt.Errorf("scan: %w", err)
+			return nil, "", fmt.Errorf("scan: %w", err)
 		}
 		dates = append(dates, d)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
 
-	return dates, rows.Err()
+	dates, more := trim(p, dates)
+	if !more {
+		return dates, "", nil
+	}
+	return dates, cursor{Kind: cursorDates, Date: dates[len(dates)-1]}.String(), nil
 }
 
-// Search performs full-text search across all notes.
-// Returns notes whose content matches the query, most recent first.
-func (s *Store) Search(query string) ([]Note, error) {
+// ListNotes returns every note of a user with its content, most recent
+// first.
+func (s *Store) ListNotes(userID int64) ([]Note, error) {
+	notes, _, err := s.ListNotesPage(userID, Page{})
+	return notes, err
+}
+
+// ListNotesPage is ListNotes one page at a time, returning the cursor of the
+// next page, empty after the last.
+func (s *Store) ListNotesPage(userID int64, p Page) ([]Note, string, error) {
+	c, err := p.parseCursor(cursorNotes)
+	if err != nil {
+		return nil, "", err
+	}
+
 	rows, err := s.db.Query(`
-		SELECT date, content, updated_at FROM notes
-		WHERE content LIKE '%' || ? || '%'
+		SELECT date, content, revision, deleted, updated_at FROM notes
+		WHERE user_id = ? AND deleted = 0 AND (? = '' OR date < ?)
 		ORDER BY date DESC
-		LIMIT 50
-	`, query)
+		LIMIT ?
+	`, userID, c.Date, c.Date, p.sqlLimit())
 	if err != nil {
-		return nil, fmt.Errorf("search: %w", err)
+		return nil, "", fmt.Errorf("list notes: %w", err)
 	}
-	defer rows.Close()
+	return scanNotePage(rows, p, cursorNotes)
+}
 
-	var results []Note
-	for rows.Next() {
-		var n Note
-		if err := rows.Scan(&n.Date, &n.Content, &n.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("scan: %w", err)
-		}
-		results = append(results, n)
+// HasEncryptedNotes reports whether any of a user's notes holds
+// client-encrypted content. Upsert keeps a flag on each note, so this is an
+// index lookup rather than a scan.
+func (s *Store) HasEncryptedNotes(userID int64) (bool, error) {
+	var found bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM notes WHERE user_id = ? AND encrypted = 1)
+	`, userID).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("has encrypted: %w", err)
 	}
+	return found, nil
+}
 
-	return results, rows.Err()
+// GetUpdatedSince returns a user's notes updated at or after the given
+// timestamp, including tombstones of deleted days.
+// Useful for incremental sync. The bound is inclusive because updated_at has
+// one-second resolution; callers de-duplicate by revision.
+func (s *Store) GetUpdatedSince(userID int64, since string) ([]Note, error) {
+	notes, _, err := s.GetUpdatedSincePage(userID, since, Page{})
+	return notes, err
 }
 
-// GetUpdatedSince returns notes updated after the given timestamp.
-// Useful for incremental sync.
-func (s *Store) GetUpdatedSince(since string) ([]Note, error) {
+// GetUpdatedSincePage is GetUpdatedSince one page at a time, most recent
+// date first, returning the cursor of the next page, empty after the last.
+func (s *Store) GetUpdatedSincePage(userID int64, since string, p Page) ([]Note, string, error) {
+	c, err := p.parseCursor(cursorSince)
+	if err != nil {
+		return nil, "", err
+	}
+
 	rows, err := s.db.Query(`
-		SELECT date, content, updated_at FROM notes
-		WHERE updated_at > ?
+		SELECT date, content, revision, deleted, updated_at FROM notes
+		WHERE user_id = ? AND updated_at >= ? AND (? = '' OR date < ?)
 		ORDER BY date DESC
-	`, since)
+		LIMIT ?
+	`, userID, since, c.Date, c.Date, p.sqlLimit())
 	if err != nil {
-		return nil, fmt.Errorf("updated since: %w", err)
+		return nil, "", fmt.Errorf("updated since: %w", err)
 	}
+	return scanNotePage(rows, p, cursorSince)
+}
+
+// scanNotePage reads notes ordered by date descending, fetched with
+// p.sqlLimit, into a page and its next cursor.
+func scanNotePage(rows *sql.Rows, p Page, kind string) ([]Note, string, error) {
 	defer rows.Close()
 
 	var results []Note
 	for rows.Next() {
 		var n Note
-		if err := rows.Scan(&n.Date, &n.Content, &n.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("scan: %w", err)
+		if err := rows.Scan(&n.Date, &n.Content, &n.Revision, &n.Deleted, &n.UpdatedAt); err != nil {
+			return nil, "", fmt.Errorf("scan: %w", err)
 		}
 		results = append(results, n)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
 
-	return results, rows.Err()
+	results, more := trim(p, results)
+	if !more {
+		return results, "", nil
+	}
+	return results, cursor{Kind: kind, Date: results[len(results)-1].Date}.String(), nil
 }
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newStore(t *testing.T) *Store {
+	t.Helper()
+	return openStore(t, filepath.Join(t.TempDir(), "scrbl.db"))
+}
+
+func TestHasEncryptedNotes(t *testing.T) {
+	s := newStore(t)
+	bob, err := s.CreateUser("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	has := func(userID int64) bool {
+		t.Helper()
+		found, err := s.HasEncryptedNotes(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return found
+	}
+	upsert := func(userID int64, date, content string) {
+		t.Helper()
+		if _, _, err := s.Upsert(userID, date, content, AnyRevision); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upsert(DefaultUserID, "2026-02-16", "plain\n")
+	if has(DefaultUserID) {
+		t.Error("plaintext notebook reported as encrypted")
+	}
+	upsert(DefaultUserID, "2026-02-17", EncryptedPrefix+"sealed")
+	if !has(DefaultUserID) || has(bob.ID) {
+		t.Error("encrypted note not reported for its owner only")
+	}
+	upsert(DefaultUserID, "2026-02-17", "plain again\n")
+	if has(DefaultUserID) {
+		t.Error("note overwritten with plaintext still reported as encrypted")
+	}
+	upsert(DefaultUserID, "2026-02-17", EncryptedPrefix+"sealed")
+	if _, _, err := s.Delete(DefaultUserID, "2026-02-17", AnyRevision); err != nil {
+		t.Fatal(err)
+	}
+	if has(DefaultUserID) {
+		t.Error("deleted encrypted note still reported")
+	}
+
+	var plan strings.Builder
+	rows, err := s.db.Query(`EXPLAIN QUERY PLAN SELECT EXISTS(SELECT 1 FROM notes WHERE user_id = ? AND encrypted = 1)`, DefaultUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan.WriteString(detail + "\n")
+	}
+	if !strings.Contains(plan.String(), "idx_notes_encrypted") {
+		t.Errorf("HasEncryptedNotes does not use its index:\n%s", plan.String())
+	}
+}
+
+func TestFlagEncryptedNotesMigration(t *testing.T) {
+	path := baselineDB(t)
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO notes (date, content) VALUES ('2025-02-04', ?)`, EncryptedPrefix+"sealed")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := openStore(t, path)
+	if found, err := s.HasEncryptedNotes(DefaultUserID); err != nil || !found {
+		t.Errorf("HasEncryptedNotes after upgrade = %v, %v; want true", found, err)
+	}
+}
+
+func TestUpsertConflicts(t *testing.T) {
+	s := newStore(t)
+	const date = "2026-02-17"
+
+	// A first write is based on revision 0, the missing note.
+	if _, conflict, err := s.Upsert(DefaultUserID, date, "first\n", 1); err != nil || !conflict {
+		t.Fatalf("Upsert of a new day based on revision 1: conflict=%v err=%v, want a conflict", conflict, err)
+	}
+	note, conflict, err := s.Upsert(DefaultUserID, date, "first\n", 0)
+	if err != nil || conflict || note.Revision != 1 {
+		t.Fatalf("first Upsert = %+v, conflict=%v err=%v; want revision 1", note, conflict, err)
+	}
+
+	// A client that missed a write gets the server copy back, unchanged.
+	if _, _, err := s.Upsert(DefaultUserID, date, "second\n", 1); err != nil {
+		t.Fatal(err)
+	}
+	current, conflict, err := s.Upsert(DefaultUserID, date, "stale\n", 1)
+	if err != nil || !conflict {
+		t.Fatalf("stale Upsert: conflict=%v err=%v, want a conflict", conflict, err)
+	}
+	if current.Content != "second\n" || current.Revision != 2 {
+		t.Errorf("conflict returned %+v, want the server copy at revision 2", current)
+	}
+	if _, conflict, err := s.Upsert(DefaultUserID, date, "again\n", 0); err != nil || !conflict {
+		t.Errorf("Upsert based on revision 0 of an existing day: conflict=%v err=%v, want a conflict", conflict, err)
+	}
+	if note, err := s.Get(DefaultUserID, date); err != nil || note.Content != "second\n" {
+		t.Errorf("note after conflicts = %+v, %v; want it untouched", note, err)
+	}
+
+	// AnyRevision overwrites whatever is there.
+	note, conflict, err = s.Upsert(DefaultUserID, date, "forced\n", AnyRevision)
+	if err != nil || conflict || note.Revision != 3 || note.Content != "forced\n" {
+		t.Errorf("forced Upsert = %+v, conflict=%v err=%v; want revision 3", note, conflict, err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s := newStore(t)
+	const date = "2026-02-17"
+
+	for _, content := range []string{"one\n", "two\n"} {
+		if _, _, err := s.Upsert(DefaultUserID, date, content, AnyRevision); err != nil {
+			t.Fatal(err)
+		}
+	}
+	note, err := s.Restore(DefaultUserID, date, 1)
+	if err != nil || note.Revision != 3 || note.Content != "one\n" {
+		t.Fatalf("Restore(1) = %+v, %v; want revision 3 with the first content", note, err)
+	}
+
+	if _, _, err := s.Delete(DefaultUserID, date, AnyRevision); err != nil {
+		t.Fatal(err)
+	}
+	note, err = s.Restore(DefaultUserID, date, 4)
+	if err != nil || note.Revision != 4 || !note.Deleted {
+		t.Errorf("restoring a tombstone onto itself = %+v, %v; want revision 4 unchanged", note, err)
+	}
+	note, err = s.Restore(DefaultUserID, date, 2)
+	if err != nil || note.Revision != 5 || note.Content != "two\n" || note.Deleted {
+		t.Errorf("Restore(2) of a deleted day = %+v, %v; want revision 5 brought back", note, err)
+	}
+
+	if note, err := s.Restore(DefaultUserID, date, 9); err != nil || note != nil {
+		t.Errorf("Restore of a missing revision = %+v, %v; want nil", note, err)
+	}
+}
+
+func TestDeleteTombstone(t *testing.T) {
+	s := newStore(t)
+	const date = "2026-02-17"
+
+	if _, _, err := s.Upsert(DefaultUserID, date, "one\n", AnyRevision); err != nil {
+		t.Fatal(err)
+	}
+	tombstone, conflict, err := s.Delete(DefaultUserID, date, 1)
+	if err != nil || conflict || !tombstone.Deleted || tombstone.Revision != 2 {
+		t.Fatalf("Delete = %+v, conflict=%v err=%v; want a tombstone at revision 2", tombstone, conflict, err)
+	}
+
+	for _, base := range []int64{2, AnyRevision} {
+		again, conflict, err := s.Delete(DefaultUserID, date, base)
+		if err != nil || conflict || *again != *tombstone {
+			t.Errorf("Delete of a tombstone based on %d = %+v, conflict=%v err=%v; want it unchanged", base, again, conflict, err)
+		}
+	}
+	if revs, err := s.ListRevisions(DefaultUserID, date); err != nil || len(revs) != 2 {
+		t.Errorf("ListRevisions = %d revisions, %v; want 2", len(revs), err)
+	}
+}
+
+func TestSearchMatchOffsets(t *testing.T) {
+	s := newStore(t)
+
+	// Control bytes and multi-byte text must not shift the offsets.
+	content := "\x01tea\x02 and café, then more tea\n"
+	if _, _, err := s.Upsert(DefaultUserID, "2026-02-16", content, AnyRevision); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.Search(DefaultUserID, SearchQuery{Text: "tea"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+
+	var got []string
+	for _, m := range results[0].Matches {
+		if m.Start < 0 || m.End > len(content) || m.Start >= m.End {
+			t.Fatalf("span %+v out of range for %d bytes", m, len(content))
+		}
+		got = append(got, content[m.Start:m.End])
+	}
+	if want := []string{"tea", "tea"}; !slices.Equal(got, want) {
+		t.Errorf("matched %q, want %q", got, want)
+	}
+}
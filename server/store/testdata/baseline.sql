@@ -0,0 +1,22 @@
+-- The schema of the first release, before schema versions were recorded,
+-- with a few notes written by it.
+CREATE TABLE IF NOT EXISTS notes (
+	date       TEXT PRIMARY KEY,
+	content    TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL DEFAULT (datetime('now')),
+	updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_notes_updated ON notes(updated_at);
+
+INSERT INTO notes (date, content, created_at, updated_at) VALUES
+	('2025-01-28', '# 2025.01.28
+
+- [09:12] standup: release blocked on migrations
+', '2025-01-28T09:12:00Z', '2025-01-28T09:12:00Z'),
+	('2025-01-29', '# 2025.01.29
+
+- [10:03] wrote the migration framework
+- [16:40] reviewed rollout plan
+', '2025-01-29T10:03:00Z', '2025-01-29T16:40:00Z'),
+	('2025-02-03', '', '2025-02-03T08:00:00Z', '2025-02-03T08:00:00Z');
@@ -0,0 +1,338 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultUserID owns notes written before the server had users, and every
+// request while no API keys are configured.
+const DefaultUserID int64 = 1
+
+// APIKeyPrefix starts every generated API key, so keys are recognisable in
+// config files and logs.
+const APIKeyPrefix = "scrbl_"
+
+// ErrUserExists is returned by CreateUser when the name is taken.
+var ErrUserExists = errors.New("user already exists")
+
+// ErrKeyNotFound is returned by RevokeAPIKey for an unknown key ID.
+var ErrKeyNotFound = errors.New("api key not found")
+
+// User owns a notebook. API keys resolve to exactly one user.
+type User struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+// APIKey describes a stored key. The key itself is never stored; Prefix is
+// its first few characters, enough to tell keys apart. Scopes limit what the
+// key may do.
+type APIKey struct {
+	ID        int64    `json:"id"`
+	UserID    int64    `json:"user_id"`
+	User      string   `json:"user"`
+	Prefix    string   `json:"prefix"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt string   `json:"created_at"`
+	RevokedAt string   `json:"revoked_at,omitempty"`
+}
+
+// keyPrefixLen is how much of a key is kept in clear for listing.
+const keyPrefixLen = 12
+
+// migrateUsers creates the users and api_keys tables and the default user.
+func migrateUsers(tx *sql.Tx) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS users (
+		id         INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL UNIQUE,
+		created_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id         INTEGER PRIMARY KEY,
+		user_id    INTEGER NOT NULL REFERENCES users(id),
+		key_hash   TEXT NOT NULL UNIQUE,
+		created_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);
+	`
+	if _, err := tx.Exec(schema); err != nil {
+		return fmt.Errorf("create users: %w", err)
+	}
+
+	// Keys created before they could be listed and revoked lack these.
+	if err := addColumnIfMissing(tx, "api_keys", "prefix", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "api_keys", "revoked_at", "TEXT"); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys(prefix)`); err != nil {
+		return fmt.Errorf("create users: %w", err)
+	}
+
+	_, err := tx.Exec(`
+		INSERT OR IGNORE INTO users (id, name, created_at) VALUES (?, 'default', ?)
+	`, DefaultUserID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("create default user: %w", err)
+	}
+	return nil
+}
+
+// CreateUser adds a user with an empty notebook.
+func (s *Store) CreateUser(name string) (*User, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("create user: name is required")
+	}
+
+	existing, err := s.UserByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrUserExists
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`INSERT INTO users (name, created_at) VALUES (?, ?)`, name, now)
+	if err != nil {
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+
+	return &User{ID: id, Name: name, CreatedAt: now}, nil
+}
+
+// UserByName looks up a user. Returns nil if not found.
+func (s *Store) UserByName(name string) (*User, error) {
+	row := s.db.QueryRow(`SELECT id, name, created_at FROM users WHERE name = ?`, name)
+
+	var u User
+	err := row.Scan(&u.ID, &u.Name, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	return &u, nil
+}
+
+// ListUsers returns every user, oldest first.
+func (s *Store) ListUsers() ([]User, error) {
+	rows, err := s.db.Query(`SELECT id, name, created_at FROM users ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Name, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// CreateAPIKey generates a new API key for a user with the given scopes.
+// Only its hash is stored, so the returned key cannot be recovered later.
+func (s *Store) CreateAPIKey(userID int64, scopes []string) (string, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", fmt.Errorf("create api key: %w", err)
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	key := APIKeyPrefix + hex.EncodeToString(buf)
+
+	_, err = s.db.Exec(`
+		INSERT INTO api_keys (user_id, key_hash, prefix, scopes, created_at) VALUES (?, ?, ?, ?, ?)
+	`, userID, HashKey(key), keyPrefix(key), strings.Join(scopes, ","), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return "", fmt.Errorf("create api key: %w", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns the keys of one user, or of every user when userID is
+// 0, oldest first.
+func (s *Store) ListAPIKeys(userID int64) ([]APIKey, error) {
+	rows, err := s.db.Query(`
+		SELECT k.id, k.user_id, u.name, k.prefix, k.scopes, k.created_at, COALESCE(k.revoked_at, '')
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE ? = 0 OR k.user_id = ?
+		ORDER BY k.id
+	`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var k APIKey
+		var scopes string
+		if err := rows.Scan(&k.ID, &k.UserID, &k.User, &k.Prefix, &scopes, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		k.Scopes = splitScopes(scopes)
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey stops a key from authenticating. The row is kept so the key
+// stays listed and cannot be registered again. Revoking a revoked key is a
+// no-op.
+func (s *Store) RevokeAPIKey(id int64) error {
+	res, err := s.db.Exec(`
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?
+	`, time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// SetAPIKeyScopes replaces the scopes of a key. Revoked keys keep their
+// scopes so the listing still shows what they could do.
+func (s *Store) SetAPIKeyScopes(id int64, scopes []string) error {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.Exec(`UPDATE api_keys SET scopes = ? WHERE id = ?`, strings.Join(scopes, ","), id)
+	if err != nil {
+		return fmt.Errorf("set api key scopes: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("set api key scopes: %w", err)
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// UserForKey resolves an API key to its user and the scopes it grants.
+// Returns a nil user if the key is unknown or revoked.
+//
+// Candidates are selected by the non-secret prefix and their hashes compared
+// in constant time, so lookup timing reveals nothing about the rest of the
+// key.
+func (s *Store) UserForKey(key string) (*User, []string, error) {
+	rows, err := s.db.Query(`
+		SELECT k.key_hash, k.scopes, u.id, u.name, u.created_at FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.prefix IN (?, '') AND k.revoked_at IS NULL
+	`, keyPrefix(key))
+	if err != nil {
+		return nil, nil, fmt.Errorf("user for key: %w", err)
+	}
+	defer rows.Close()
+
+	want := []byte(HashKey(key))
+	var found *User
+	var scopes []string
+	for rows.Next() {
+		var hash, granted string
+		var u User
+		if err := rows.Scan(&hash, &granted, &u.ID, &u.Name, &u.CreatedAt); err != nil {
+			return nil, nil, fmt.Errorf("scan: %w", err)
+		}
+		// Keep comparing after a match so every candidate costs the same.
+		if subtle.ConstantTimeCompare([]byte(hash), want) == 1 {
+			found, scopes = &u, splitScopes(granted)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("user for key: %w", err)
+	}
+
+	return found, scopes, nil
+}
+
+// UserForKeyHash is UserForKey for a key known only by its HashKey, such as
+// the key a web session was opened with. Returns a nil user if the key is
+// unknown or revoked.
+func (s *Store) UserForKeyHash(hash string) (*User, []string, error) {
+	row := s.db.QueryRow(`
+		SELECT k.scopes, u.id, u.name, u.created_at FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = ? AND k.revoked_at IS NULL
+	`, hash)
+
+	var u User
+	var granted string
+	err := row.Scan(&granted, &u.ID, &u.Name, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("user for key: %w", err)
+	}
+	return &u, splitScopes(granted), nil
+}
+
+// HasAPIKeys reports whether any API key was ever registered, revoked or
+// not. Without keys the server runs unauthenticated as the default user, so
+// revoking every key must not reopen it.
+func (s *Store) HasAPIKeys() (bool, error) {
+	var found bool
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM api_keys)`).Scan(&found); err != nil {
+		return false, fmt.Errorf("has api keys: %w", err)
+	}
+	return found, nil
+}
+
+// keyPrefix keeps at most a third of short hand-picked keys, such as one
+// passed with -api-key, so the prefix never gives most of the key away.
+func keyPrefix(key string) string {
+	return key[:min(keyPrefixLen, len(key)/3)]
+}
+
+// HashKey returns the stored form of an API key, and of the other secret
+// tokens the store hands out. They are long random strings, so a fast
+// unsalted hash is enough to keep them out of the DB.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
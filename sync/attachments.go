@@ -0,0 +1,107 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrAttachmentNotFound is returned by PullAttachment when the server has no
+// attachment with the requested hash.
+var ErrAttachmentNotFound = errors.New("attachment not found on the server")
+
+// AttachmentHash returns the name an attachment is stored under: the hex
+// SHA-256 of its plaintext.
+func AttachmentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// PushAttachment uploads a file unless the server already has it and returns
+// its hash. With a Cipher the file is encrypted and its type withheld, so
+// the server only learns its hash and size.
+func (c *Client) PushAttachment(ctx context.Context, data []byte, contentType string) (string, error) {
+	hash := AttachmentHash(data)
+	if c == nil || c.ServerURL == "" {
+		return hash, nil
+	}
+	path := "/api/attachments/" + hash
+
+	resp, err := c.send(ctx, http.MethodHead, path, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return hash, nil
+	}
+
+	body := data
+	if c.Cipher != nil {
+		sealed, err := c.Cipher.Encrypt(string(data))
+		if err != nil {
+			return "", err
+		}
+		body = []byte(sealed)
+		contentType = "application/octet-stream"
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	resp, err = c.sendRequest(ctx, http.MethodPut, path, body, http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return hash, nil
+}
+
+// PullAttachment downloads the file stored under hash, decrypting it if
+// needed, and checks that it matches the hash.
+func (c *Client) PullAttachment(ctx context.Context, hash string) ([]byte, error) {
+	if c == nil || c.ServerURL == "" {
+		return nil, ErrAttachmentNotFound
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, "/api/attachments/"+hash, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrAttachmentNotFound
+	}
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read attachment: %w", err)
+	}
+	if bytes.HasPrefix(data, []byte(EncryptedPrefix)) {
+		plain, err := c.open(string(data))
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(plain)
+	}
+
+	if AttachmentHash(data) != hash {
+		return nil, fmt.Errorf("attachment %s does not match its hash", hash)
+	}
+	return data, nil
+}
@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// batchSize is how many notes PushNotes sends per request. The server accepts
+// up to 500.
+const batchSize = 100
+
+// LocalNote is a day's local content to push.
+type LocalNote struct {
+	Date    time.Time
+	Content string
+}
+
+// PushResult is the outcome of pushing one note in a batch. Err is a
+// *ConflictError when the server copy changed since the last sync.
+type PushResult struct {
+	Date string
+	Err  error
+}
+
+// PushNotes uploads many notes using the batch endpoint, a chunk at a time.
+// Revisions are checked against State as in PushNote unless force is set.
+// The returned error covers transport failures; per-note outcomes are in the
+// results.
+func (c *Client) PushNotes(notes []LocalNote, force bool) ([]PushResult, error) {
+	return c.PushNotesContext(context.Background(), notes, force)
+}
+
+// PushNotesContext is PushNotes with a context that bounds all retries.
+func (c *Client) PushNotesContext(ctx context.Context, notes []LocalNote, force bool) ([]PushResult, error) {
+	if c == nil || c.ServerURL == "" {
+		return nil, nil
+	}
+
+	results := make([]PushResult, 0, len(notes))
+	for start := 0; start < len(notes); start += batchSize {
+		end := min(start+batchSize, len(notes))
+		chunk := notes[start:end]
+
+		req := apiv1.BatchRequest{Notes: make([]apiv1.PutNoteRequest, 0, len(chunk))}
+		local := make(map[string]string, len(chunk))
+		for _, n := range chunk {
+			key := n.Date.Format("2006-01-02")
+			sealed, err := c.seal(n.Content)
+			if err != nil {
+				return results, err
+			}
+			payload := apiv1.PutNoteRequest{Date: key, Content: sealed}
+			if c.State != nil && !force {
+				base := c.State.Revision(key)
+				payload.BaseRevision = &base
+			}
+			req.Notes = append(req.Notes, payload)
+			local[key] = n.Content
+		}
+
+		body, err := json.Marshal(req)
+		if err != nil {
+			return results, fmt.Errorf("marshal error: %w", err)
+		}
+		// Retrying is safe: a batch the server applied but whose response
+		// was lost comes back as conflicts with the content we sent, which
+		// count as pushed, or when forced writes the same content again.
+		httpResp, err := c.roundTrip(ctx, "POST", "/api/notes/batch", body, nil, true)
+		if err != nil {
+			return results, err
+		}
+		var resp apiv1.BatchResponse
+		if err := decodeJSON(httpResp, &resp); err != nil {
+			return results, err
+		}
+
+		for _, r := range resp.Results {
+			result := PushResult{Date: r.Date}
+			switch {
+			case r.Status == apiv1.BatchOK && r.Note != nil:
+				r.Note.Content = local[r.Date]
+				result.Err = c.recordSynced(*r.Note)
+			case r.Status == apiv1.BatchConflict && r.Note != nil:
+				content, err := c.open(r.Note.Content)
+				if err != nil {
+					result.Err = err
+					break
+				}
+				r.Note.Content = content
+				// Both sides already agree, so only the bookkeeping was stale.
+				if !r.Note.Deleted && content == local[r.Date] {
+					result.Err = c.recordSynced(*r.Note)
+				} else {
+					result.Err = &ConflictError{Date: r.Date, RemoteContent: r.Note.Content, RemoteRevision: r.Note.Revision, RemoteDeleted: r.Note.Deleted}
+				}
+			default:
+				result.Err = fmt.Errorf("server rejected note: %s", r.Error)
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// PullAllNotes fetches every note with its content, a page of PageSize notes
+// per request. Nothing is recorded in State; call RecordSynced for each note
+// written locally.
+func (c *Client) PullAllNotes() ([]RemoteNote, error) {
+	return collect(c.Notes(context.Background()))
+}
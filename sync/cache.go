@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Cache keeps the last response body and ETag of selected GET requests on
+// disk, so they can be revalidated with If-None-Match and answered with 304
+// Not Modified instead of a full body.
+type Cache struct {
+	dir string
+}
+
+type cacheEntry struct {
+	Path string `json:"path"`
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+}
+
+// NewCache returns a cache stored in dir. The directory is created on first
+// write.
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+func (c *Cache) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:12])+".json")
+}
+
+func (c *Cache) get(key string) (cacheEntry, bool) {
+	var e cacheEntry
+	if c == nil {
+		return e, false
+	}
+	b, err := os.ReadFile(c.file(key))
+	if err != nil {
+		return e, false
+	}
+	// A corrupt entry is just a miss.
+	if err := json.Unmarshal(b, &e); err != nil || e.Path != key {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+func (c *Cache) put(key string, e cacheEntry) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("create cache dir: %w", err)
+	}
+
+	e.Path = key
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode cache entry: %w", err)
+	}
+
+	path := c.file(key)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	return nil
+}
+
+func (c *Cache) remove(key string) {
+	if c == nil {
+		return
+	}
+	os.Remove(c.file(key))
+}
+
+// getCached sends a GET for path, revalidating a cached copy when there is
+// one. A 304 is turned into a 200 carrying the cached body, so callers never
+// see it. Other responses are returned as-is; successful ones with an ETag
+// are cached first.
+func (c *Client) getCached(ctx context.Context, path string) (*http.Response, error) {
+	if c.Cache == nil {
+		return c.send(ctx, "GET", path, nil)
+	}
+
+	key := c.ServerURL + path
+	cached, ok := c.Cache.get(key)
+
+	var header http.Header
+	if ok {
+		header = http.Header{"If-None-Match": {cached.ETag}}
+	}
+
+	resp, err := c.sendRequest(ctx, "GET", path, nil, header)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && ok:
+		resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Body = io.NopCloser(bytes.NewReader(cached.Body))
+		return resp, nil
+
+	case resp.StatusCode == http.StatusNotFound:
+		c.Cache.remove(key)
+		return resp, nil
+
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("sync error: %w", err)
+		}
+		// Failing to cache only costs a full download next time.
+		c.Cache.put(key, cacheEntry{ETag: resp.Header.Get("ETag"), Body: body})
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+
+	return resp, nil
+}
@@ -1,12 +1,15 @@
 package sync
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
 )
 
 // Client handles syncing notes to/from a remote server.
@@ -14,6 +17,26 @@ type Client struct {
 	ServerURL  string
 	APIKey     string
 	HTTPClient *http.Client
+
+	// State, when set, tracks the server revision of each synced day so
+	// pushes are rejected instead of overwriting newer remote changes.
+	State *State
+
+	// Outbox, when set, holds days whose push failed. A day leaves the
+	// outbox as soon as it is in sync with the server.
+	Outbox *Outbox
+
+	// Cipher, when set, encrypts content before it is sent and decrypts it
+	// on the way back, so the server only ever stores ciphertext.
+	Cipher *Cipher
+
+	// Retry controls retries of transient failures. HTTPClient's timeout
+	// applies to each attempt.
+	Retry RetryPolicy
+
+	// Cache, when set, keeps pulled notes and lists with their ETags so
+	// unchanged ones are answered with 304 Not Modified.
+	Cache *Cache
 }
 
 // NewClient creates a new sync client.
@@ -27,24 +50,71 @@ func NewClient(serverURL, apiKey string) *Client {
 		HTTPClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		Retry: DefaultRetryPolicy,
+	}
+}
+
+// RemoteNote is a note as stored on the server. Deleted notes are tombstones
+// with empty content.
+type RemoteNote = apiv1.Note
+
+// ConflictError is returned by PushNote when the server copy of a day changed
+// since this client last synced it.
+type ConflictError struct {
+	Date           string
+	RemoteContent  string
+	RemoteRevision int64
+	RemoteDeleted  bool
+}
+
+func (e *ConflictError) Error() string {
+	if e.RemoteDeleted {
+		return fmt.Sprintf("conflict on %s: remote note was deleted since last sync (remote revision %d)", e.Date, e.RemoteRevision)
 	}
+	return fmt.Sprintf("conflict on %s: remote note changed since last sync (remote revision %d)", e.Date, e.RemoteRevision)
 }
 
-// notePayload is the JSON body for push/pull.
-type notePayload struct {
-	Date    string `json:"date"`
-	Content string `json:"content"`
+// IsConflict reports whether err is a push conflict.
+func IsConflict(err error) bool {
+	var conflict *ConflictError
+	return errors.As(err, &conflict)
 }
 
-// PushNote uploads a day's note content to the server.
+// PushNote uploads a day's note content to the server. If State is set and
+// the server has a newer revision than the one last synced, the push is
+// rejected with a *ConflictError.
 func (c *Client) PushNote(date time.Time, content string) error {
+	return c.pushNote(context.Background(), date, content, false)
+}
+
+// PushNoteContext is PushNote with a context that bounds all retries.
+func (c *Client) PushNoteContext(ctx context.Context, date time.Time, content string) error {
+	return c.pushNote(ctx, date, content, false)
+}
+
+// ForcePushNote uploads a day's note content, overwriting the server copy
+// regardless of its revision.
+func (c *Client) ForcePushNote(date time.Time, content string) error {
+	return c.pushNote(context.Background(), date, content, true)
+}
+
+func (c *Client) pushNote(ctx context.Context, date time.Time, content string, force bool) error {
 	if c == nil || c.ServerURL == "" {
 		return nil
 	}
 
-	payload := notePayload{
-		Date:    date.Format("2006-01-02"),
-		Content: content,
+	key := date.Format("2006-01-02")
+	sealed, err := c.seal(content)
+	if err != nil {
+		return err
+	}
+	payload := apiv1.PutNoteRequest{
+		Date:    key,
+		Content: sealed,
+	}
+	if c.State != nil && !force {
+		base := c.State.Revision(key)
+		payload.BaseRevision = &base
 	}
 
 	body, err := json.Marshal(payload)
@@ -52,50 +122,94 @@ func (c *Client) PushNote(date time.Time, content string) error {
 		return fmt.Errorf("marshal error: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/api/notes/%s", c.ServerURL, date.Format("2006-01-02"))
-	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	resp, err := c.send(ctx, "PUT", "/api/notes/"+key, body)
 	if err != nil {
-		return fmt.Errorf("request error: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	if c.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+		return err
 	}
+	defer resp.Body.Close()
 
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("sync error: %w", err)
+	if resp.StatusCode == http.StatusConflict {
+		var remote RemoteNote
+		if err := json.NewDecoder(resp.Body).Decode(&remote); err != nil {
+			return fmt.Errorf("decode error: %w", err)
+		}
+		if remote.Content, err = c.open(remote.Content); err != nil {
+			return err
+		}
+		// Both sides already agree, so only the bookkeeping was stale.
+		if !remote.Deleted && remote.Content == content {
+			return c.recordSynced(remote)
+		}
+		return &ConflictError{Date: key, RemoteContent: remote.Content, RemoteRevision: remote.Revision, RemoteDeleted: remote.Deleted}
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
 		respBody, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	return nil
+	var saved RemoteNote
+	if err := json.NewDecoder(resp.Body).Decode(&saved); err != nil {
+		return fmt.Errorf("decode error: %w", err)
+	}
+	saved.Content = content
+
+	return c.recordSynced(saved)
 }
 
-// PullNote downloads a day's note content from the server.
-func (c *Client) PullNote(date time.Time) (string, error) {
-	if c == nil || c.ServerURL == "" {
-		return "", nil
+// seal encrypts content for the server when a Cipher is configured.
+func (c *Client) seal(content string) (string, error) {
+	if c.Cipher == nil {
+		return content, nil
 	}
+	return c.Cipher.Encrypt(content)
+}
 
-	url := fmt.Sprintf("%s/api/notes/%s", c.ServerURL, date.Format("2006-01-02"))
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("request error: %w", err)
+// open decrypts content received from the server.
+func (c *Client) open(content string) (string, error) {
+	if c.Cipher == nil {
+		if IsEncrypted(content) {
+			return "", ErrNoCipher
+		}
+		return content, nil
+	}
+	return c.Cipher.Decrypt(content)
+}
+
+// recordSynced notes that the local and server copies of a day agree. State
+// is updated before the day leaves the outbox, so a day is never seen as
+// neither queued nor synced.
+func (c *Client) recordSynced(n RemoteNote) error {
+	if c.State != nil {
+		ns := NoteState{
+			Revision:  n.Revision,
+			UpdatedAt: n.UpdatedAt,
+			Deleted:   n.Deleted,
+		}
+		if !n.Deleted {
+			ns.Hash = ContentHash(n.Content)
+		}
+		if err := c.State.Record(n.Date, ns); err != nil {
+			return err
+		}
 	}
+	return c.Outbox.Remove(n.Date)
+}
+
+// PullNote downloads a day's note content from the server.
+func (c *Client) PullNote(date time.Time) (string, error) {
+	return c.PullNoteContext(context.Background(), date)
+}
 
-	if c.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+// PullNoteContext is PullNote with a context that bounds all retries.
+func (c *Client) PullNoteContext(ctx context.Context, date time.Time) (string, error) {
+	if c == nil || c.ServerURL == "" {
+		return "", nil
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.getCached(ctx, "/api/notes/"+date.Format("2006-01-02"))
 	if err != nil {
-		return "", fmt.Errorf("sync error: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -108,44 +222,88 @@ func (c *Client) PullNote(date time.Time) (string, error) {
 		return "", fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	var payload notePayload
+	var payload RemoteNote
 	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
 		return "", fmt.Errorf("decode error: %w", err)
 	}
+	if payload.Content, err = c.open(payload.Content); err != nil {
+		return "", err
+	}
+
+	if err := c.recordSynced(payload); err != nil {
+		return "", err
+	}
 
 	return payload.Content, nil
 }
 
 // PullAllDates fetches the list of available dates from the server.
 func (c *Client) PullAllDates() ([]string, error) {
+	return c.PullAllDatesContext(context.Background())
+}
+
+// PullAllDatesContext is PullAllDates with a context that bounds all retries.
+func (c *Client) PullAllDatesContext(ctx context.Context) ([]string, error) {
 	if c == nil || c.ServerURL == "" {
 		return nil, nil
 	}
 
-	url := fmt.Sprintf("%s/api/notes", c.ServerURL)
-	req, err := http.NewRequest("GET", url, nil)
+	return collect(c.Dates(ctx))
+}
+
+// PullUpdatedSince fetches every note the server changed after since, an
+// updated_at timestamp, including tombstones of deleted days. An empty since
+// fetches every note. Nothing is
+// recorded in State; callers decide which of the returned notes to apply.
+func (c *Client) PullUpdatedSince(since string) ([]RemoteNote, error) {
+	return collect(c.NotesUpdatedSince(context.Background(), since))
+}
+
+// RecordSynced marks a day as in sync with the given server copy.
+func (c *Client) RecordSynced(n RemoteNote) error {
+	return c.recordSynced(n)
+}
+
+// getJSON is doJSON for a GET whose response goes through Cache.
+func (c *Client) getJSON(ctx context.Context, path string, out any) error {
+	resp, err := c.getCached(ctx, path)
 	if err != nil {
-		return nil, fmt.Errorf("request error: %w", err)
+		return err
 	}
+	return decodeJSON(resp, out)
+}
 
-	if c.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+// doJSON sends a request to path with in, if non-nil, as the JSON body and
+// decodes the JSON response into out.
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshal error: %w", err)
+		}
+		body = b
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.send(ctx, method, path, body)
 	if err != nil {
-		return nil, fmt.Errorf("sync error: %w", err)
+		return err
 	}
+	return decodeJSON(resp, out)
+}
+
+// decodeJSON decodes a JSON response into out and closes its body. Error
+// statuses are returned as errors carrying the response text.
+func decodeJSON(resp *http.Response, out any) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server returned %d", resp.StatusCode)
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	var dates []string
-	if err := json.NewDecoder(resp.Body).Decode(&dates); err != nil {
-		return nil, fmt.Errorf("decode error: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode error: %w", err)
 	}
-
-	return dates, nil
+	return nil
 }
@@ -0,0 +1,587 @@
+package sync_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+	"github.com/juliuswalton/scrbl-server/apiv1/apitest"
+	syncclient "github.com/juliuswalton/scrbl/sync"
+)
+
+// fakeServer is an in-memory implementation of the API, just enough for the
+// client to run against. Its responses are built from the apiv1 types; the
+// apitest.Checker around it holds both sides to the OpenAPI document.
+type fakeServer struct {
+	mu          gosync.Mutex
+	notes       map[string]apiv1.Note
+	revisions   map[string][]apiv1.Revision
+	attachments map[string][]byte
+	shares      map[string]apiv1.Share
+	clock       time.Time
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		notes:       map[string]apiv1.Note{},
+		revisions:   map[string][]apiv1.Revision{},
+		attachments: map[string][]byte{},
+		shares:      map[string]apiv1.Share{},
+		clock:       time.Date(2026, 2, 17, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func (f *fakeServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/notes", f.list)
+	mux.HandleFunc("POST /api/notes/batch", f.batch)
+	mux.HandleFunc("GET /api/notes/{date}", f.get)
+	mux.HandleFunc("PUT /api/notes/{date}", f.put)
+	mux.HandleFunc("DELETE /api/notes/{date}", f.delete)
+	mux.HandleFunc("GET /api/notes/{date}/revisions", f.listRevisions)
+	mux.HandleFunc("GET /api/notes/{date}/revisions/{revision}", f.getRevision)
+	mux.HandleFunc("POST /api/notes/{date}/revisions/{revision}/restore", f.restore)
+	mux.HandleFunc("GET /api/search", f.search)
+	mux.HandleFunc("GET /api/events", f.events)
+	mux.HandleFunc("HEAD /api/attachments/{hash}", f.getAttachment)
+	mux.HandleFunc("GET /api/attachments/{hash}", f.getAttachment)
+	mux.HandleFunc("PUT /api/attachments/{hash}", f.putAttachment)
+	mux.HandleFunc("POST /api/notes/{date}/share", f.createShare)
+	mux.HandleFunc("DELETE /api/shares/{token}", f.revokeShare)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// write stores a note as the next revision. Callers hold f.mu.
+func (f *fakeServer) write(date, content string, deleted bool) apiv1.Note {
+	f.clock = f.clock.Add(time.Minute)
+	n := apiv1.Note{
+		Date:      date,
+		Content:   content,
+		Revision:  f.notes[date].Revision + 1,
+		UpdatedAt: f.clock.Format(time.RFC3339),
+		Deleted:   deleted,
+	}
+	f.notes[date] = n
+	f.revisions[date] = append(f.revisions[date], apiv1.Revision{
+		Date:      date,
+		Revision:  n.Revision,
+		Content:   content,
+		Size:      len(content),
+		CreatedAt: n.UpdatedAt,
+		Deleted:   deleted,
+	})
+	return n
+}
+
+// upsert applies a PutNoteRequest, reporting a conflict as the real server
+// does. Callers hold f.mu.
+func (f *fakeServer) upsert(req apiv1.PutNoteRequest) (apiv1.Note, bool) {
+	current := f.notes[req.Date]
+	if req.BaseRevision != nil && *req.BaseRevision != current.Revision {
+		return current, true
+	}
+	return f.write(req.Date, req.Content, false), false
+}
+
+func (f *fakeServer) sorted() []apiv1.Note {
+	var notes []apiv1.Note
+	for _, n := range f.notes {
+		notes = append(notes, n)
+	}
+	slices.SortFunc(notes, func(a, b apiv1.Note) int { return strings.Compare(b.Date, a.Date) })
+	return notes
+}
+
+func (f *fakeServer) list(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := r.URL.Query()
+	var notes []apiv1.Note
+	for _, n := range f.sorted() {
+		switch {
+		case q.Has("since"):
+			if n.UpdatedAt >= q.Get("since") {
+				notes = append(notes, n)
+			}
+		case !n.Deleted:
+			notes = append(notes, n)
+		}
+	}
+
+	if q.Get("include") == "content" || q.Has("since") {
+		writeJSON(w, http.StatusOK, apiv1.Page[apiv1.Note]{Items: notes})
+		return
+	}
+	dates := []string{}
+	for _, n := range notes {
+		dates = append(dates, n.Date)
+	}
+	writeJSON(w, http.StatusOK, apiv1.Page[string]{Items: dates})
+}
+
+func (f *fakeServer) get(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, ok := f.notes[r.PathValue("date")]
+	if !ok || n.Deleted {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+func (f *fakeServer) put(w http.ResponseWriter, r *http.Request) {
+	var req apiv1.PutNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.Date = r.PathValue("date")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, conflict := f.upsert(req)
+	if conflict {
+		writeJSON(w, http.StatusConflict, n)
+		return
+	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+func (f *fakeServer) delete(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	date := r.PathValue("date")
+	current, ok := f.notes[date]
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if raw := r.URL.Query().Get("base_revision"); raw != "" {
+		if base, _ := strconv.ParseInt(raw, 10, 64); base != current.Revision {
+			writeJSON(w, http.StatusConflict, current)
+			return
+		}
+	}
+	if current.Deleted {
+		writeJSON(w, http.StatusOK, current)
+		return
+	}
+	writeJSON(w, http.StatusOK, f.write(date, "", true))
+}
+
+func (f *fakeServer) batch(w http.ResponseWriter, r *http.Request) {
+	var req apiv1.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := apiv1.BatchResponse{Results: []apiv1.BatchResult{}}
+	for _, n := range req.Notes {
+		note, conflict := f.upsert(n)
+		status := apiv1.BatchOK
+		if conflict {
+			status = apiv1.BatchConflict
+		}
+		resp.Results = append(resp.Results, apiv1.BatchResult{Date: n.Date, Status: status, Note: &note})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (f *fakeServer) listRevisions(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	revs := []apiv1.Revision{}
+	for _, rev := range slices.Backward(f.revisions[r.PathValue("date")]) {
+		rev.Content = ""
+		revs = append(revs, rev)
+	}
+	writeJSON(w, http.StatusOK, revs)
+}
+
+// revision looks up the revision in the path. Callers hold f.mu.
+func (f *fakeServer) revision(r *http.Request) (apiv1.Revision, bool) {
+	n, _ := strconv.ParseInt(r.PathValue("revision"), 10, 64)
+	for _, rev := range f.revisions[r.PathValue("date")] {
+		if rev.Revision == n {
+			return rev, true
+		}
+	}
+	return apiv1.Revision{}, false
+}
+
+func (f *fakeServer) getRevision(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rev, ok := f.revision(r)
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, rev)
+}
+
+func (f *fakeServer) restore(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rev, ok := f.revision(r)
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, f.write(rev.Date, rev.Content, rev.Deleted))
+}
+
+func (f *fakeServer) search(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := r.URL.Query()
+	results := []apiv1.SearchResult{}
+	for _, n := range f.sorted() {
+		i := strings.Index(n.Content, q.Get("q"))
+		if n.Deleted || i < 0 {
+			continue
+		}
+		results = append(results, apiv1.SearchResult{
+			Date:      n.Date,
+			Snippet:   n.Content,
+			Matches:   []apiv1.Span{{Start: i, End: i + len(q.Get("q"))}},
+			Score:     1,
+			UpdatedAt: n.UpdatedAt,
+		})
+	}
+
+	if q.Has("limit") || q.Has("cursor") {
+		writeJSON(w, http.StatusOK, apiv1.Page[apiv1.SearchResult]{Items: results})
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (f *fakeServer) events(w http.ResponseWriter, r *http.Request) {
+	change, err := json.Marshal(apiv1.NoteChange{Date: "2026-02-17", Revision: 9, UpdatedAt: "2026-02-17T10:00:00Z"})
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, "event: %s\ndata: {}\n\n", apiv1.EventReady)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", apiv1.EventNote, change)
+	http.NewResponseController(w).Flush()
+	<-r.Context().Done()
+}
+
+func (f *fakeServer) getAttachment(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	data, ok := f.attachments[r.PathValue("hash")]
+	f.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+func (f *fakeServer) putAttachment(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	hash := r.PathValue("hash")
+	f.attachments[hash] = data
+	writeJSON(w, http.StatusCreated, apiv1.Attachment{
+		Hash:        hash,
+		Size:        int64(len(data)),
+		ContentType: r.Header.Get("Content-Type"),
+		CreatedAt:   f.clock.Format(time.RFC3339),
+	})
+}
+
+func (f *fakeServer) createShare(w http.ResponseWriter, r *http.Request) {
+	var req apiv1.ShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	date := r.PathValue("date")
+	if n, ok := f.notes[date]; !ok || n.Deleted {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	token := fmt.Sprintf("%032x", len(f.shares)+1)
+	share := apiv1.Share{
+		Token:     token,
+		Date:      date,
+		Path:      "/s/" + token,
+		CreatedAt: f.clock.Format(time.RFC3339),
+		ExpiresAt: req.ExpiresAt,
+	}
+	f.shares[token] = share
+	writeJSON(w, http.StatusCreated, share)
+}
+
+func (f *fakeServer) revokeShare(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token := r.PathValue("token")
+	if _, ok := f.shares[token]; !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	delete(f.shares, token)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newContractClient is TestClientContract's setup for focused tests: a fake
+// server checked against the OpenAPI document, and a client with sync state.
+func newContractClient(t *testing.T) (*fakeServer, *syncclient.Client) {
+	t.Helper()
+
+	fake := newFakeServer()
+	ts := httptest.NewServer(apitest.Default().Check(t, fake.handler()))
+	t.Cleanup(ts.Close)
+
+	state, err := syncclient.LoadState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := syncclient.NewClient(ts.URL, "scrbl_test")
+	c.State = state
+	c.Retry = syncclient.RetryPolicy{MaxAttempts: 1}
+	return fake, c
+}
+
+// TestClientContract drives every client call that talks to the server and
+// checks the traffic against the OpenAPI document.
+func TestClientContract(t *testing.T) {
+	fake := newFakeServer()
+	checker := apitest.Default().Check(t, fake.handler())
+	ts := httptest.NewServer(checker)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	state, err := syncclient.LoadState(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := syncclient.NewClient(ts.URL, "scrbl_test")
+	c.State = state
+	c.Retry = syncclient.RetryPolicy{MaxAttempts: 1}
+
+	day := time.Date(2026, 2, 17, 0, 0, 0, 0, time.UTC)
+	next := day.AddDate(0, 0, 1)
+
+	if err := c.PushNote(day, "first draft"); err != nil {
+		t.Fatalf("PushNote: %v", err)
+	}
+	if err := c.PushNote(day, "second draft"); err != nil {
+		t.Fatalf("PushNote: %v", err)
+	}
+	if got, err := c.PullNote(day); err != nil || got != "second draft" {
+		t.Fatalf("PullNote = %q, %v", got, err)
+	}
+
+	// Another client writes; this one is now behind.
+	fake.mu.Lock()
+	fake.write("2026-02-17", "from elsewhere", false)
+	fake.mu.Unlock()
+	if err := c.PushNote(day, "third draft"); !syncclient.IsConflict(err) {
+		t.Fatalf("PushNote behind the server = %v, want a conflict", err)
+	}
+	if err := c.ForcePushNote(day, "third draft"); err != nil {
+		t.Fatalf("ForcePushNote: %v", err)
+	}
+
+	results, err := c.PushNotes([]syncclient.LocalNote{
+		{Date: next, Content: "batched"},
+		{Date: day, Content: "third draft"},
+	}, false)
+	if err != nil {
+		t.Fatalf("PushNotes: %v", err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("PushNotes %s: %v", r.Date, r.Err)
+		}
+	}
+
+	dates, err := c.PullAllDates()
+	if err != nil || !slices.Equal(dates, []string{"2026-02-18", "2026-02-17"}) {
+		t.Fatalf("PullAllDates = %v, %v", dates, err)
+	}
+	if notes, err := c.PullAllNotes(); err != nil || len(notes) != 2 {
+		t.Fatalf("PullAllNotes = %v, %v", notes, err)
+	}
+	if notes, err := c.PullUpdatedSince(""); err != nil || len(notes) != 2 {
+		t.Fatalf("PullUpdatedSince = %v, %v", notes, err)
+	}
+
+	revs, err := c.ListRevisions(day)
+	if err != nil || len(revs) == 0 {
+		t.Fatalf("ListRevisions = %v, %v", revs, err)
+	}
+	if rev, err := c.GetRevision(day, 1); err != nil || rev.Content != "first draft" {
+		t.Fatalf("GetRevision = %+v, %v", rev, err)
+	}
+	if note, err := c.RestoreRevision(day, 1); err != nil || note.Content != "first draft" {
+		t.Fatalf("RestoreRevision = %+v, %v", note, err)
+	}
+
+	if found, err := c.Search("draft", "2026-01-01", ""); err != nil || len(found) != 1 {
+		t.Fatalf("Search = %v, %v", found, err)
+	}
+	for _, err := range c.SearchAll(context.Background(), "batched", "", "") {
+		if err != nil {
+			t.Fatalf("SearchAll: %v", err)
+		}
+	}
+
+	if err := c.DeleteNote(next); err != nil {
+		t.Fatalf("DeleteNote: %v", err)
+	}
+	if err := c.DeleteNote(day.AddDate(0, 0, -30)); err != nil {
+		t.Fatalf("DeleteNote of a missing day: %v", err)
+	}
+
+	file := []byte("attachment body")
+	hash, err := c.PushAttachment(context.Background(), file, "text/plain")
+	if err != nil {
+		t.Fatalf("PushAttachment: %v", err)
+	}
+	if _, err := c.PushAttachment(context.Background(), file, "text/plain"); err != nil {
+		t.Fatalf("PushAttachment again: %v", err)
+	}
+	if got, err := c.PullAttachment(context.Background(), hash); err != nil || string(got) != string(file) {
+		t.Fatalf("PullAttachment = %q, %v", got, err)
+	}
+	if _, err := c.PullAttachment(context.Background(), syncclient.AttachmentHash([]byte("other"))); !errors.Is(err, syncclient.ErrAttachmentNotFound) {
+		t.Fatalf("PullAttachment of a missing file = %v", err)
+	}
+
+	share, err := c.ShareNote(context.Background(), day, day.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatalf("ShareNote: %v", err)
+	}
+	if got := c.ShareURL(share); got != ts.URL+"/s/"+share.Token {
+		t.Errorf("ShareURL = %s", got)
+	}
+	if _, err := c.ShareNote(context.Background(), next, time.Time{}); !errors.Is(err, syncclient.ErrNoteNotFound) {
+		t.Errorf("ShareNote of a deleted day = %v, want ErrNoteNotFound", err)
+	}
+	if err := c.RevokeShare(context.Background(), share.Token); err != nil {
+		t.Fatalf("RevokeShare: %v", err)
+	}
+	if err := c.RevokeShare(context.Background(), share.Token); err == nil {
+		t.Error("RevokeShare of a revoked share succeeded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var events []syncclient.NoteEvent
+	c.SubscribeEvents(ctx, func(ev syncclient.NoteEvent) {
+		events = append(events, ev)
+		if ev.Type == syncclient.EventNote {
+			cancel()
+		}
+	})
+	if len(events) != 2 || events[1].Date != "2026-02-17" || events[1].Revision != 9 {
+		t.Errorf("events = %+v", events)
+	}
+
+	ts.Close()
+	if missing := checker.Uncovered("health", "metrics", "openapi", "backup", "sharedNote", "sharedAttachment"); len(missing) > 0 {
+		t.Errorf("operations the client never calls: %v", missing)
+	}
+}
+
+// TestPushOverTombstone checks that a batch pushed against a day deleted
+// elsewhere reports the deletion, even when the local copy is empty too.
+func TestPushOverTombstone(t *testing.T) {
+	fake, c := newContractClient(t)
+	day := time.Date(2026, 2, 17, 0, 0, 0, 0, time.UTC)
+
+	for _, content := range []string{"edited\n", ""} {
+		if err := c.ForcePushNote(day, "synced\n"); err != nil {
+			t.Fatal(err)
+		}
+		fake.mu.Lock()
+		fake.write("2026-02-17", "", true)
+		fake.mu.Unlock()
+
+		results, err := c.PushNotes([]syncclient.LocalNote{{Date: day, Content: content}}, false)
+		if err != nil {
+			t.Fatalf("PushNotes: %v", err)
+		}
+		var conflict *syncclient.ConflictError
+		if len(results) != 1 || !errors.As(results[0].Err, &conflict) || !conflict.RemoteDeleted {
+			t.Errorf("PushNotes of %q over a tombstone = %+v, want a conflict with RemoteDeleted", content, results)
+		}
+	}
+}
+
+// TestDeleteDeletedDay checks that deleting a day that is already a
+// tombstone, whether the client knew it or not, succeeds without writing a
+// new revision.
+func TestDeleteDeletedDay(t *testing.T) {
+	fake, c := newContractClient(t)
+	day := time.Date(2026, 2, 17, 0, 0, 0, 0, time.UTC)
+
+	if err := c.PushNote(day, "synced\n"); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	tombstone := fake.write("2026-02-17", "", true)
+	fake.mu.Unlock()
+
+	// Once deleted elsewhere, then again after the client caught up.
+	for range 2 {
+		if err := c.DeleteNote(day); err != nil {
+			t.Fatalf("DeleteNote of a deleted day: %v", err)
+		}
+		fake.mu.Lock()
+		got := fake.notes["2026-02-17"]
+		fake.mu.Unlock()
+		if got != tombstone {
+			t.Errorf("server copy = %+v, want the tombstone %+v unchanged", got, tombstone)
+		}
+		if rev := c.State.Revision("2026-02-17"); rev != tombstone.Revision {
+			t.Errorf("state revision = %d, want the tombstone's %d", rev, tombstone.Revision)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package sync
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	gosync "sync"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// EncryptedPrefix marks note content encrypted by a Cipher. The server
+// recognises it to know a notebook is encrypted, so it must not change.
+const EncryptedPrefix = apiv1.EncryptedPrefix
+
+const (
+	saltSize         = 16
+	keySize          = 32
+	pbkdf2Iterations = 600_000
+	minKeyFileSize   = 32
+)
+
+// ErrNoCipher is returned when the server holds encrypted content but no
+// passphrase or key file is configured.
+var ErrNoCipher = errors.New("note is encrypted on the server; set encryption_passphrase or encryption_key_file in the config")
+
+// Cipher encrypts note content before it leaves the client with AES-256-GCM.
+//
+// Ciphertext is EncryptedPrefix followed by base64(salt | nonce | sealed).
+// The key is derived from a secret and the salt, so every device sharing the
+// secret can decrypt notes written by any other. Derived keys are cached per
+// salt because passphrase derivation is deliberately slow.
+type Cipher struct {
+	derive func(salt []byte) ([]byte, error)
+	salt   []byte
+
+	mu   gosync.Mutex
+	keys map[string][]byte
+}
+
+// NewPassphraseCipher derives keys from a passphrase with PBKDF2-SHA256.
+// salt is used for content this client encrypts and should be stable across
+// runs to keep the key cache small.
+func NewPassphraseCipher(passphrase string, salt []byte) (*Cipher, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("empty encryption passphrase")
+	}
+
+	derive := func(salt []byte) ([]byte, error) {
+		return pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, keySize)
+	}
+	return newCipher(derive, salt)
+}
+
+// NewKeyFileCipher derives keys from the contents of a key file with
+// HKDF-SHA256. The file must hold at least 32 bytes of random data.
+func NewKeyFileCipher(path string, salt []byte) (*Cipher, error) {
+	secret, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read encryption key file: %w", err)
+	}
+	if len(secret) < minKeyFileSize {
+		return nil, fmt.Errorf("encryption key file must hold at least %d bytes", minKeyFileSize)
+	}
+
+	derive := func(salt []byte) ([]byte, error) {
+		return hkdf.Key(sha256.New, secret, salt, "scrbl note key", keySize)
+	}
+	return newCipher(derive, salt)
+}
+
+func newCipher(derive func(salt []byte) ([]byte, error), salt []byte) (*Cipher, error) {
+	if len(salt) != saltSize {
+		return nil, fmt.Errorf("encryption salt must be %d bytes", saltSize)
+	}
+	return &Cipher{derive: derive, salt: salt, keys: map[string][]byte{}}, nil
+}
+
+// NewSalt returns a random salt suitable for NewPassphraseCipher and
+// NewKeyFileCipher.
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+// IsEncrypted reports whether content was produced by a Cipher.
+func IsEncrypted(content string) bool {
+	return strings.HasPrefix(content, EncryptedPrefix)
+}
+
+// Encrypt seals plaintext note content.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	aead, err := c.aead(c.salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, saltSize+len(nonce)+len(plaintext)+aead.Overhead())
+	out = append(out, c.salt...)
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, []byte(plaintext), nil)
+
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Decrypt opens content sealed by Encrypt. Content without EncryptedPrefix,
+// such as notes pushed before encryption was enabled, is returned unchanged.
+func (c *Cipher) Decrypt(content string) (string, error) {
+	if !IsEncrypted(content) {
+		return content, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(content, EncryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted note: %w", err)
+	}
+	if len(raw) < saltSize {
+		return "", fmt.Errorf("encrypted note is truncated")
+	}
+
+	aead, err := c.aead(raw[:saltSize])
+	if err != nil {
+		return "", err
+	}
+
+	rest := raw[saltSize:]
+	if len(rest) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted note is truncated")
+	}
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+
+	plain, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt note: wrong key or corrupted content")
+	}
+	return string(plain), nil
+}
+
+func (c *Cipher) aead(salt []byte) (cipher.AEAD, error) {
+	c.mu.Lock()
+	key, ok := c.keys[string(salt)]
+	c.mu.Unlock()
+
+	if !ok {
+		var err error
+		key, err = c.derive(salt)
+		if err != nil {
+			return nil, fmt.Errorf("derive key: %w", err)
+		}
+		c.mu.Lock()
+		c.keys[string(salt)] = key
+		c.mu.Unlock()
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
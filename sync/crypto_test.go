@@ -0,0 +1,94 @@
+package sync_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	syncclient "github.com/juliuswalton/scrbl/sync"
+)
+
+// TestCipherAcrossDevices checks the promise in the Cipher doc: devices
+// sharing a secret but each with its own salt can read each other's notes.
+func TestCipherAcrossDevices(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, bytes.Repeat([]byte{7}, 32), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	otherKeyFile := filepath.Join(t.TempDir(), "other")
+	if err := os.WriteFile(otherKeyFile, bytes.Repeat([]byte{8}, 32), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		new  func(salt []byte) (*syncclient.Cipher, error)
+		// wrong is the same kind of cipher with a different secret.
+		wrong func(salt []byte) (*syncclient.Cipher, error)
+	}{
+		{
+			name: "passphrase",
+			new: func(salt []byte) (*syncclient.Cipher, error) {
+				return syncclient.NewPassphraseCipher("correct horse", salt)
+			},
+			wrong: func(salt []byte) (*syncclient.Cipher, error) {
+				return syncclient.NewPassphraseCipher("battery staple", salt)
+			},
+		},
+		{
+			name:  "key file",
+			new:   func(salt []byte) (*syncclient.Cipher, error) { return syncclient.NewKeyFileCipher(keyFile, salt) },
+			wrong: func(salt []byte) (*syncclient.Cipher, error) { return syncclient.NewKeyFileCipher(otherKeyFile, salt) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var devices []*syncclient.Cipher
+			for range 2 {
+				salt, err := syncclient.NewSalt()
+				if err != nil {
+					t.Fatal(err)
+				}
+				c, err := tt.new(salt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				devices = append(devices, c)
+			}
+
+			const note = "# 2026.02.17\n\n- [09:12] standup\n"
+			for i, from := range devices {
+				to := devices[1-i]
+				sealed, err := from.Encrypt(note)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !syncclient.IsEncrypted(sealed) || strings.Contains(sealed, "standup") {
+					t.Fatalf("Encrypt = %q, want opaque ciphertext", sealed)
+				}
+				if got, err := to.Decrypt(sealed); err != nil || got != note {
+					t.Errorf("device %d reading device %d's note = %q, %v", 1-i, i, got, err)
+				}
+			}
+
+			salt, err := syncclient.NewSalt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wrong, err := tt.wrong(salt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sealed, err := devices[0].Encrypt(note)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := wrong.Decrypt(sealed); err == nil {
+				t.Error("a different secret decrypted the note")
+			}
+		})
+	}
+}
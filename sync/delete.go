@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeleteNote deletes a day on the server, leaving a tombstone that other
+// clients pick up on their next sync. If State is set and the server copy
+// changed since it was last synced, the delete is rejected with a
+// *ConflictError. Deleting a day the server never had succeeds.
+func (c *Client) DeleteNote(date time.Time) error {
+	return c.deleteNote(context.Background(), date, false)
+}
+
+// ForceDeleteNote deletes a day on the server regardless of its revision.
+func (c *Client) ForceDeleteNote(date time.Time) error {
+	return c.deleteNote(context.Background(), date, true)
+}
+
+func (c *Client) deleteNote(ctx context.Context, date time.Time, force bool) error {
+	if c == nil || c.ServerURL == "" {
+		return nil
+	}
+
+	key := date.Format("2006-01-02")
+	path := "/api/notes/" + key
+	if c.State != nil && !force {
+		path += "?base_revision=" + strconv.FormatInt(c.State.Revision(key), 10)
+	}
+
+	resp, err := c.send(ctx, "DELETE", path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return c.recordSynced(RemoteNote{Date: key, Deleted: true})
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		var remote RemoteNote
+		if err := json.NewDecoder(resp.Body).Decode(&remote); err != nil {
+			return fmt.Errorf("decode error: %w", err)
+		}
+		// Deleted elsewhere too, so only the bookkeeping was stale.
+		if remote.Deleted {
+			return c.recordSynced(remote)
+		}
+		if remote.Content, err = c.open(remote.Content); err != nil {
+			return err
+		}
+		return &ConflictError{Date: key, RemoteContent: remote.Content, RemoteRevision: remote.Revision}
+	}
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var tombstone RemoteNote
+	if err := json.NewDecoder(resp.Body).Decode(&tombstone); err != nil {
+		return fmt.Errorf("decode error: %w", err)
+	}
+
+	return c.recordSynced(tombstone)
+}
@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// eventsIdleTimeout is how long a change feed may stay silent before it is
+// treated as dead. The server sends a heartbeat well within it.
+const eventsIdleTimeout = 75 * time.Second
+
+// Event types sent on the change feed.
+const (
+	// EventReady is sent once the subscription is active.
+	EventReady = apiv1.EventReady
+	// EventNote is sent for every write to a note.
+	EventNote = apiv1.EventNote
+)
+
+// NoteEvent is one message from the server's change feed. Note events carry
+// the date, revision and deleted flag of a changed day, but not its content.
+type NoteEvent struct {
+	Type string `json:"-"`
+	apiv1.NoteChange
+}
+
+// SubscribeEvents streams note changes from the server to handle until ctx
+// is cancelled or the connection drops, and returns the reason it stopped.
+// It does not reconnect; callers decide how to back off. handle runs on the
+// calling goroutine and should not block for long.
+func (c *Client) SubscribeEvents(ctx context.Context, handle func(NoteEvent)) error {
+	if c == nil || c.ServerURL == "" {
+		return nil
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.ServerURL+"/api/events", nil)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	// The stream is long-lived, so HTTPClient's overall timeout cannot apply.
+	hc := &http.Client{}
+	if c.HTTPClient != nil {
+		hc.Transport = c.HTTPClient.Transport
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		if parent.Err() != nil {
+			return fmt.Errorf("sync error: %w", parent.Err())
+		}
+		return fmt.Errorf("sync error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	idle := time.AfterFunc(eventsIdleTimeout, cancel)
+	defer idle.Stop()
+
+	var eventType, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		idle.Reset(eventsIdleTimeout)
+
+		line := scanner.Text()
+		if line == "" {
+			if eventType != "" {
+				ev := NoteEvent{Type: eventType}
+				if eventType == EventNote {
+					if err := json.Unmarshal([]byte(data), &ev); err != nil {
+						return fmt.Errorf("decode error: %w", err)
+					}
+				}
+				handle(ev)
+			}
+			eventType, data = "", ""
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			if data != "" {
+				data += "\n"
+			}
+			data += value
+		}
+	}
+
+	switch {
+	case parent.Err() != nil:
+		return fmt.Errorf("sync error: %w", parent.Err())
+	case ctx.Err() != nil:
+		return fmt.Errorf("event stream idle for %s", eventsIdleTimeout)
+	case scanner.Err() != nil:
+		return fmt.Errorf("event stream error: %w", scanner.Err())
+	}
+	return fmt.Errorf("event stream closed by server")
+}
@@ -0,0 +1,260 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	gosync "sync"
+	"time"
+)
+
+// Outbox is a durable queue of days whose push failed, so they can be retried
+// once the server is reachable again. Only dates are queued; the current
+// local content is read when the outbox is drained.
+type Outbox struct {
+	path string
+	mu   gosync.Mutex
+
+	Pending map[string]OutboxEntry `json:"pending"`
+}
+
+// OutboxEntry describes one queued day.
+type OutboxEntry struct {
+	QueuedAt  string `json:"queued_at"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// LoadOutbox reads the outbox file at path. A missing file yields an empty
+// outbox.
+func LoadOutbox(path string) (*Outbox, error) {
+	ob := &Outbox{path: path, Pending: map[string]OutboxEntry{}}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ob, nil
+		}
+		return nil, fmt.Errorf("read outbox: %w", err)
+	}
+
+	if err := json.Unmarshal(b, ob); err != nil {
+		return nil, fmt.Errorf("parse outbox: %w", err)
+	}
+	if ob.Pending == nil {
+		ob.Pending = map[string]OutboxEntry{}
+	}
+
+	return ob, nil
+}
+
+// Len returns the number of queued days.
+func (o *Outbox) Len() int {
+	if o == nil {
+		return 0
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.Pending)
+}
+
+// Dates returns the queued days, oldest first.
+func (o *Outbox) Dates() []string {
+	if o == nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	dates := make([]string, 0, len(o.Pending))
+	for date := range o.Pending {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// Has reports whether date is queued.
+func (o *Outbox) Has(date string) bool {
+	if o == nil {
+		return false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	_, ok := o.Pending[date]
+	return ok
+}
+
+// Add queues date. Queuing a day that is already queued is a no-op, so a
+// push can be queued before it is attempted and survive being interrupted.
+func (o *Outbox) Add(date string) error {
+	if o == nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.Pending[date]; ok {
+		return nil
+	}
+	o.Pending[date] = OutboxEntry{QueuedAt: time.Now().UTC().Format(time.RFC3339)}
+
+	return o.saveLocked()
+}
+
+// MarkFailed records a failed push attempt for date, queuing it if needed.
+func (o *Outbox) MarkFailed(date string, cause error) error {
+	if o == nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, ok := o.Pending[date]
+	if !ok {
+		entry.QueuedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	entry.Attempts++
+	if cause != nil {
+		entry.LastError = cause.Error()
+	}
+	o.Pending[date] = entry
+
+	return o.saveLocked()
+}
+
+// Remove drops date from the queue. Removing a day that is not queued is a
+// no-op.
+func (o *Outbox) Remove(date string) error {
+	if o == nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.Pending[date]; !ok {
+		return nil
+	}
+	delete(o.Pending, date)
+
+	return o.saveLocked()
+}
+
+func (o *Outbox) saveLocked() error {
+	if o.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(o.path), 0o755); err != nil {
+		return fmt.Errorf("create outbox dir: %w", err)
+	}
+
+	b, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode outbox: %w", err)
+	}
+
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+
+	return nil
+}
+
+// DrainResult summarises one DrainOutbox run.
+type DrainResult struct {
+	Pushed    int
+	Conflicts []string
+	Remaining int
+}
+
+// DrainOutbox pushes every day queued in c.Outbox, reading its current local
+// content with read. Pushed days leave the queue through State bookkeeping.
+// Conflicting days are dropped from the queue and returned, since retrying
+// cannot resolve them. If the server cannot be reached the queue is kept and
+// the error returned.
+func (c *Client) DrainOutbox(read func(day time.Time) (string, error)) (DrainResult, error) {
+	return c.DrainOutboxContext(context.Background(), read)
+}
+
+// DrainOutboxContext is DrainOutbox with a context that bounds all retries.
+// A cancelled drain leaves the queue intact.
+func (c *Client) DrainOutboxContext(ctx context.Context, read func(day time.Time) (string, error)) (DrainResult, error) {
+	var res DrainResult
+	if c == nil || c.ServerURL == "" || c.Outbox.Len() == 0 {
+		return res, nil
+	}
+
+	var batch []LocalNote
+	for _, date := range c.Outbox.Dates() {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			if err := c.Outbox.Remove(date); err != nil {
+				return res, err
+			}
+			continue
+		}
+
+		content, err := read(day)
+		if err != nil {
+			return res, err
+		}
+		// The day file is gone; there is nothing left to push.
+		if content == "" {
+			if err := c.Outbox.Remove(date); err != nil {
+				return res, err
+			}
+			continue
+		}
+		batch = append(batch, LocalNote{Date: day, Content: content})
+	}
+
+	results, err := c.PushNotesContext(ctx, batch, false)
+	if err != nil {
+		if IsCanceled(err) {
+			res.Remaining = c.Outbox.Len()
+			return res, err
+		}
+		for _, n := range batch {
+			if markErr := c.Outbox.MarkFailed(n.Date.Format("2006-01-02"), err); markErr != nil {
+				return res, markErr
+			}
+		}
+		res.Remaining = c.Outbox.Len()
+		return res, err
+	}
+
+	for _, r := range results {
+		switch {
+		case r.Err == nil:
+			res.Pushed++
+		case IsConflict(r.Err):
+			res.Conflicts = append(res.Conflicts, r.Date)
+			if err := c.Outbox.Remove(r.Date); err != nil {
+				return res, err
+			}
+		default:
+			if err := c.Outbox.MarkFailed(r.Date, r.Err); err != nil {
+				return res, err
+			}
+		}
+	}
+
+	res.Remaining = c.Outbox.Len()
+	return res, nil
+}
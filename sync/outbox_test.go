@@ -0,0 +1,94 @@
+package sync_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	syncclient "github.com/juliuswalton/scrbl/sync"
+)
+
+// TestOutboxSurvivesRestart queues days, reloads the outbox from disk as a
+// restarted TUI would, and drains it oldest first.
+func TestOutboxSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	ob, err := syncclient.LoadOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, date := range []string{"2026-02-18", "2026-02-16", "2026-02-17"} {
+		if err := ob.Add(date); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ob.MarkFailed("2026-02-17", errors.New("connection refused")); err != nil {
+		t.Fatal(err)
+	}
+
+	ob, err = syncclient.LoadOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2026-02-16", "2026-02-17", "2026-02-18"}
+	if got := ob.Dates(); !slices.Equal(got, want) {
+		t.Fatalf("reloaded Dates = %v, want %v", got, want)
+	}
+	if e := ob.Pending["2026-02-17"]; e.Attempts != 1 || e.LastError != "connection refused" {
+		t.Errorf("reloaded entry = %+v, want the failed attempt kept", e)
+	}
+
+	fake, c := newContractClient(t)
+	c.Outbox = ob
+	read := func(day time.Time) (string, error) { return "note for " + day.Format("2006-01-02") + "\n", nil }
+	res, err := c.DrainOutbox(read)
+	if err != nil || res.Pushed != 3 || res.Remaining != 0 {
+		t.Fatalf("DrainOutbox = %+v, %v; want 3 pushed", res, err)
+	}
+
+	// The fake server's clock ticks on every write, so write order shows.
+	for i := 1; i < len(want); i++ {
+		if before, after := fake.notes[want[i-1]], fake.notes[want[i]]; before.UpdatedAt >= after.UpdatedAt {
+			t.Errorf("%s was pushed after %s", want[i-1], want[i])
+		}
+	}
+
+	if ob, err := syncclient.LoadOutbox(path); err != nil || ob.Len() != 0 {
+		t.Errorf("outbox on disk after draining has %d days, %v; want none", ob.Len(), err)
+	}
+}
+
+// TestOutboxKeptWhileOffline checks that a drain against an unreachable
+// server keeps every day queued and records the attempt on disk.
+func TestOutboxKeptWhileOffline(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	ob, err := syncclient.LoadOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ob.Add("2026-02-17"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := syncclient.NewClient(ts.URL, "scrbl_test")
+	c.Retry = syncclient.RetryPolicy{MaxAttempts: 1}
+	c.Outbox = ob
+	res, err := c.DrainOutbox(func(time.Time) (string, error) { return "note\n", nil })
+	if err == nil || res.Remaining != 1 {
+		t.Fatalf("DrainOutbox offline = %+v, %v; want an error with the day kept", res, err)
+	}
+
+	ob, err = syncclient.LoadOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := ob.Pending["2026-02-17"]; !ok || e.Attempts != 1 || e.LastError == "" {
+		t.Errorf("outbox on disk = %+v, want the day with one failed attempt", ob.Pending)
+	}
+}
@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	neturl "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// PageSize is how many items the paging iterators fetch per request.
+const PageSize = 500
+
+// paginate walks the listing at path one page at a time, through Cache when
+// cached is set. Servers that predate pagination answer with the whole
+// listing as an array, which is taken as a single last page. Iteration stops
+// at the first error.
+func paginate[T any](ctx context.Context, c *Client, path string, cached bool) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		if c == nil || c.ServerURL == "" {
+			return
+		}
+
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+
+		var zero T
+		cursor := ""
+		for {
+			params := neturl.Values{"limit": {strconv.Itoa(PageSize)}}
+			if cursor != "" {
+				params.Set("cursor", cursor)
+			}
+
+			var raw json.RawMessage
+			var err error
+			if cached {
+				err = c.getJSON(ctx, path+sep+params.Encode(), &raw)
+			} else {
+				err = c.doJSON(ctx, "GET", path+sep+params.Encode(), nil, &raw)
+			}
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+
+			var pg apiv1.Page[T]
+			target := any(&pg)
+			if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+				target = &pg.Items
+			}
+			if err := json.Unmarshal(raw, target); err != nil {
+				yield(zero, fmt.Errorf("decode error: %w", err))
+				return
+			}
+
+			for _, item := range pg.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if pg.NextCursor == "" {
+				return
+			}
+			cursor = pg.NextCursor
+		}
+	}
+}
+
+// opened decrypts the notes of a listing as they are yielded.
+func (c *Client) opened(notes iter.Seq2[RemoteNote, error]) iter.Seq2[RemoteNote, error] {
+	return func(yield func(RemoteNote, error) bool) {
+		for n, err := range notes {
+			if err == nil {
+				n.Content, err = c.open(n.Content)
+				if err != nil {
+					err = fmt.Errorf("%s: %w", n.Date, err)
+				}
+			}
+			if !yield(n, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Dates iterates over the dates of every note on the server, most recent
+// first, fetching them a page at a time.
+func (c *Client) Dates(ctx context.Context) iter.Seq2[string, error] {
+	return paginate[string](ctx, c, "/api/notes", true)
+}
+
+// Notes iterates over every note on the server with its content, most
+// recent first, fetching them a page at a time.
+func (c *Client) Notes(ctx context.Context) iter.Seq2[RemoteNote, error] {
+	return c.opened(paginate[RemoteNote](ctx, c, "/api/notes?include=content", true))
+}
+
+// NotesUpdatedSince iterates over the notes the server changed after since,
+// an updated_at timestamp, including tombstones of deleted days. An empty
+// since selects every note.
+func (c *Client) NotesUpdatedSince(ctx context.Context, since string) iter.Seq2[RemoteNote, error] {
+	if since == "" {
+		since = "1970-01-01T00:00:00Z"
+	}
+	return c.opened(paginate[RemoteNote](ctx, c, "/api/notes?since="+neturl.QueryEscape(since), false))
+}
+
+// SearchAll iterates over every result of a full-text query, best first,
+// with the same arguments as Search but without its cap of 50 results.
+func (c *Client) SearchAll(ctx context.Context, query, from, to string) iter.Seq2[SearchResult, error] {
+	return paginate[SearchResult](ctx, c, "/api/search?"+searchParams(query, from, to).Encode(), false)
+}
+
+// collect gathers an iterator's items, stopping at the first error.
+func collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	var items []T
+	for item, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,190 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how requests are retried after network errors and
+// 429, 500, 502, 503 or 504 responses. Other responses, such as the 501 the
+// server sends for what it can never do, are returned to the caller as is.
+// Only GET, HEAD, PUT and DELETE requests are retried, as repeating them is
+// harmless. A POST, such as creating a share link, is tried once, except
+// for batch pushes, which are safe to repeat.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first. Values
+	// below 1 mean a single attempt.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry. It doubles on every
+	// further retry, up to MaxDelay, with up to 50% random jitter added.
+	// A server asking for a longer wait in Retry-After is not retried; the
+	// request fails with a *RetryAfterError instead. Zero MaxDelay means
+	// DefaultRetryPolicy's.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// RetryAfterError is returned when the server asks the client to wait
+// longer than RetryPolicy.MaxDelay, as it does for a locked out client.
+type RetryAfterError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("server returned %d: try again in %s", e.StatusCode, e.RetryAfter.Round(time.Second))
+}
+
+// DefaultRetryPolicy is used by NewClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    8 * time.Second,
+}
+
+// maxDelay returns the longest wait before a retry.
+func (p RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay > 0 {
+		return p.MaxDelay
+	}
+	return DefaultRetryPolicy.MaxDelay
+}
+
+// backoff returns the wait before retry number n, starting at 1.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	limit := p.maxDelay()
+	d := p.BaseDelay
+	for i := 1; i < n && d > 0 && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d + rand.N(d/2+1)
+}
+
+// send performs a request against the server, retrying transient failures
+// according to c.Retry if the method is idempotent. body may be nil. The
+// caller owns the returned response body.
+func (c *Client) send(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	return c.sendRequest(ctx, method, path, body, nil)
+}
+
+// sendRequest is send with extra request headers.
+func (c *Client) sendRequest(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	return c.roundTrip(ctx, method, path, body, header, idempotent(method))
+}
+
+// roundTrip is sendRequest with the caller deciding whether the request may
+// be retried, for a POST that is safe to repeat.
+func (c *Client) roundTrip(ctx context.Context, method, path string, body []byte, header http.Header, retry bool) (*http.Response, error) {
+	attempts := 1
+	if retry {
+		attempts = max(c.Retry.MaxAttempts, 1)
+	}
+
+	for attempt := 1; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.ServerURL+path, reader)
+		if err != nil {
+			return nil, fmt.Errorf("request error: %w", err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if body != nil && req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.APIKey)
+		}
+
+		resp, err := c.HTTPClient.Do(req)
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("sync error: %w", ctx.Err())
+			}
+			if attempt >= attempts {
+				return nil, fmt.Errorf("sync error: %w", err)
+			}
+			wait = c.Retry.backoff(attempt)
+		case retryableStatus(resp.StatusCode) && attempt < attempts:
+			wait = retryAfter(resp)
+			// Drain so the connection can be reused.
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if wait > c.Retry.maxDelay() {
+				return nil, &RetryAfterError{StatusCode: resp.StatusCode, RetryAfter: wait}
+			}
+			if wait < 0 {
+				wait = c.Retry.backoff(attempt)
+			}
+		default:
+			return resp, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("sync error: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header as seconds or an HTTP date. It
+// returns -1 when the header is absent or invalid.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return -1
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return -1
+}
+
+// IsCanceled reports whether err is the result of the caller cancelling a
+// request's context.
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,123 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRetryAfterTooLong checks that a Retry-After beyond MaxDelay, as sent
+// to a locked out client, fails the request at once instead of sleeping.
+func TestRetryAfterTooLong(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "900")
+		http.Error(w, "too many failed attempts", http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "scrbl_test")
+	c.Retry = RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+
+	start := time.Now()
+	_, err := c.PullAllDatesContext(context.Background())
+	var retryErr *RetryAfterError
+	if !errors.As(err, &retryErr) || retryErr.RetryAfter != 900*time.Second {
+		t.Fatalf("PullAllDates = %v, want a RetryAfterError for 15m", err)
+	}
+	if calls.Load() != 1 || time.Since(start) > 5*time.Second {
+		t.Errorf("made %d calls in %s, want 1 without waiting", calls.Load(), time.Since(start))
+	}
+}
+
+// TestNotImplementedNotRetried checks that 501, which the server sends for
+// search and sharing of encrypted notes, fails without retries.
+func TestNotImplementedNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "search is unavailable for encrypted notebooks", http.StatusNotImplemented)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "scrbl_test")
+	c.Retry = RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	if _, err := c.Search("anything", "", ""); err == nil {
+		t.Fatal("Search succeeded against a 501")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("made %d calls, want 1", calls.Load())
+	}
+}
+
+// TestBackoffDefaultMaxDelay checks that a policy without MaxDelay still
+// doubles its waits, up to DefaultRetryPolicy's MaxDelay.
+func TestBackoffDefaultMaxDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 8, BaseDelay: time.Second}
+	for n, want := range []time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 8 * time.Second, 6: 8 * time.Second} {
+		if n == 0 {
+			continue
+		}
+		if got := p.backoff(n); got < want || got > want*3/2 {
+			t.Errorf("backoff(%d) = %s, want %s plus up to 50%% jitter", n, got, want)
+		}
+	}
+}
+
+// TestBackoffAtMaxDelay checks that jitter on a backoff already at MaxDelay
+// is not mistaken for a Retry-After that is too long.
+func TestBackoffAtMaxDelay(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "scrbl_test")
+	c.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	_, err := c.PullAllDatesContext(context.Background())
+	var retryErr *RetryAfterError
+	if err == nil || errors.As(err, &retryErr) {
+		t.Fatalf("PullAllDates = %v, want the 503", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("made %d calls, want 3", calls.Load())
+	}
+}
+
+// TestPostNotRetried checks that a POST which is not safe to repeat, such as
+// creating a share link, is tried once, while a batch push is retried.
+func TestPostNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "scrbl_test")
+	c.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	if _, err := c.ShareNote(context.Background(), time.Now(), time.Time{}); err == nil {
+		t.Fatal("ShareNote succeeded against a 503")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("ShareNote made %d calls, want 1", calls.Load())
+	}
+
+	calls.Store(0)
+	if _, err := c.PushNotes([]LocalNote{{Date: time.Now(), Content: "x"}}, false); err == nil {
+		t.Fatal("PushNotes succeeded against a 503")
+	}
+	if calls.Load() != 3 {
+		t.Errorf("PushNotes made %d calls, want 3", calls.Load())
+	}
+}
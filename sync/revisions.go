@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// Revision is one historical version of a day's note on the server.
+type Revision = apiv1.Revision
+
+// ListRevisions fetches the history of a day, newest first. Content is not
+// included; use GetRevision for that.
+func (c *Client) ListRevisions(date time.Time) ([]Revision, error) {
+	if c == nil || c.ServerURL == "" {
+		return nil, nil
+	}
+
+	var revs []Revision
+	path := fmt.Sprintf("/api/notes/%s/revisions", date.Format("2006-01-02"))
+	if err := c.doJSON(context.Background(), "GET", path, nil, &revs); err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+// GetRevision fetches one historical version of a day's note.
+func (c *Client) GetRevision(date time.Time, revision int64) (*Revision, error) {
+	if c == nil || c.ServerURL == "" {
+		return nil, nil
+	}
+
+	var rev Revision
+	path := fmt.Sprintf("/api/notes/%s/revisions/%d", date.Format("2006-01-02"), revision)
+	if err := c.doJSON(context.Background(), "GET", path, nil, &rev); err != nil {
+		return nil, err
+	}
+
+	content, err := c.open(rev.Content)
+	if err != nil {
+		return nil, err
+	}
+	rev.Content = content
+	return &rev, nil
+}
+
+// RestoreRevision makes an older revision the current server copy of a day
+// and returns the resulting note. The restored note is recorded in State, so
+// callers should write it locally.
+func (c *Client) RestoreRevision(date time.Time, revision int64) (*RemoteNote, error) {
+	if c == nil || c.ServerURL == "" {
+		return nil, nil
+	}
+
+	var note RemoteNote
+	path := fmt.Sprintf("/api/notes/%s/revisions/%d/restore", date.Format("2006-01-02"), revision)
+	if err := c.doJSON(context.Background(), "POST", path, nil, &note); err != nil {
+		return nil, err
+	}
+
+	content, err := c.open(note.Content)
+	if err != nil {
+		return nil, err
+	}
+	note.Content = content
+
+	if err := c.RecordSynced(note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
@@ -0,0 +1,39 @@
+package sync
+
+import (
+	"context"
+	neturl "net/url"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// SearchResult is one note matched by the server's full-text search.
+type SearchResult = apiv1.SearchResult
+
+// Search runs a full-text query on the server, optionally limited to dates
+// between from and to (inclusive, YYYY-MM-DD, empty for no bound). Snippets
+// wrap matches in <mark> tags. Servers holding encrypted notes refuse to
+// search. Only the best 50 results are returned; SearchAll returns them all.
+func (c *Client) Search(query, from, to string) ([]SearchResult, error) {
+	if c == nil || c.ServerURL == "" {
+		return nil, nil
+	}
+
+	var results []SearchResult
+	path := "/api/search?" + searchParams(query, from, to).Encode()
+	if err := c.doJSON(context.Background(), "GET", path, nil, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func searchParams(query, from, to string) neturl.Values {
+	params := neturl.Values{"q": {query}}
+	if from != "" {
+		params.Set("from", from)
+	}
+	if to != "" {
+		params.Set("to", to)
+	}
+	return params
+}
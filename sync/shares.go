@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juliuswalton/scrbl-server/apiv1"
+)
+
+// ErrNoteNotFound is returned by ShareNote when the server has no note for
+// the day, for example because it was never pushed.
+var ErrNoteNotFound = errors.New("note not found on the server")
+
+// Share is a public link to one day's note on the server.
+type Share = apiv1.Share
+
+// ShareNote creates a link to a day's note that works without an API key.
+// With a zero expires the link works until it is revoked. Encrypted notes
+// cannot be shared, as the server cannot render them.
+func (c *Client) ShareNote(ctx context.Context, date, expires time.Time) (*Share, error) {
+	if c == nil || c.ServerURL == "" {
+		return nil, fmt.Errorf("sharing needs a server")
+	}
+
+	var req apiv1.ShareRequest
+	if !expires.IsZero() {
+		req.ExpiresAt = expires.UTC().Format(time.RFC3339)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal error: %w", err)
+	}
+
+	path := fmt.Sprintf("/api/notes/%s/share", date.Format("2006-01-02"))
+	resp, err := c.send(ctx, http.MethodPost, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNoteNotFound
+	}
+
+	var share Share
+	if err := decodeJSON(resp, &share); err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// RevokeShare stops a link created with ShareNote from working.
+func (c *Client) RevokeShare(ctx context.Context, token string) error {
+	if c == nil || c.ServerURL == "" {
+		return fmt.Errorf("sharing needs a server")
+	}
+
+	resp, err := c.send(ctx, http.MethodDelete, "/api/shares/"+token, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("no share with token %s", token)
+	}
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// ShareURL returns the full address of a link on the client's server.
+func (c *Client) ShareURL(share *Share) string {
+	return strings.TrimSuffix(c.ServerURL, "/") + share.Path
+}
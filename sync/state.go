@@ -0,0 +1,173 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	gosync "sync"
+)
+
+// State remembers what this client last saw on the server for each day, so
+// pushes can tell the server which revision they are based on and reconcile
+// can tell which side changed.
+type State struct {
+	path string
+	mu   gosync.Mutex
+
+	// Since is the newest server updated_at seen by a reconcile. It is sent
+	// as ?since= so only remote changes are fetched.
+	Since string               `json:"since,omitempty"`
+	Notes map[string]NoteState `json:"notes"`
+
+	// Salt is this installation's key-derivation salt for encrypted notes.
+	Salt string `json:"encryption_salt,omitempty"`
+}
+
+// NoteState is the last synced state of a single day.
+type NoteState struct {
+	Revision  int64  `json:"revision"`
+	Hash      string `json:"hash,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	// Deleted records that the day was deleted on both sides.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// ContentHash returns the hash recorded for synced note content.
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadState reads the sync state file at path. A missing file yields an
+// empty state.
+func LoadState(path string) (*State, error) {
+	st := &State{path: path, Notes: map[string]NoteState{}}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, fmt.Errorf("read sync state: %w", err)
+	}
+
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("parse sync state: %w", err)
+	}
+	if st.Notes == nil {
+		st.Notes = map[string]NoteState{}
+	}
+
+	return st, nil
+}
+
+// CipherSalt returns this installation's encryption salt, generating and
+// persisting one on first use.
+func (s *State) CipherSalt() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Salt != "" {
+		return hex.DecodeString(s.Salt)
+	}
+
+	salt, err := NewSalt()
+	if err != nil {
+		return nil, err
+	}
+	s.Salt = hex.EncodeToString(salt)
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// Revision returns the last synced revision for date, or 0 if the day has
+// never been synced.
+func (s *State) Revision(date string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Notes[date].Revision
+}
+
+// Note returns the last synced state for date.
+func (s *State) Note(date string) (NoteState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns, ok := s.Notes[date]
+	return ns, ok
+}
+
+// SyncedDates returns every day last synced with content, i.e. not deleted.
+func (s *State) SyncedDates() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dates := make([]string, 0, len(s.Notes))
+	for date, ns := range s.Notes {
+		if !ns.Deleted {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+// Record stores the synced state for date and persists the state.
+func (s *State) Record(date string, ns NoteState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Notes[date] = ns
+	return s.saveLocked()
+}
+
+// SinceCursor returns the server timestamp to fetch remote changes from.
+func (s *State) SinceCursor() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Since
+}
+
+// AdvanceSince moves the since cursor forward to updatedAt and persists the
+// state. Older timestamps are ignored.
+func (s *State) AdvanceSince(updatedAt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if updatedAt <= s.Since {
+		return nil
+	}
+	s.Since = updatedAt
+	return s.saveLocked()
+}
+
+func (s *State) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("create sync state dir: %w", err)
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode sync state: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("write sync state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("write sync state: %w", err)
+	}
+
+	return nil
+}
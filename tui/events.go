@@ -0,0 +1,173 @@
+package tui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/juliuswalton/scrbl/sync"
+)
+
+const (
+	eventsRetryMin = 2 * time.Second
+	eventsRetryMax = time.Minute
+)
+
+type remoteEventMsg struct {
+	ev sync.NoteEvent
+}
+
+type eventsClosedMsg struct {
+	err error
+}
+
+type eventsReconnectMsg struct{}
+
+type remotePulledMsg struct {
+	day      time.Time
+	deleted  bool
+	conflict bool
+	skipped  bool
+	err      error
+}
+
+// listenEventsCmd subscribes to the server's change feed in the background.
+// Messages from the subscription arrive one at a time through m.events; the
+// handler of each one waits for the next.
+func (m Model) listenEventsCmd() tea.Cmd {
+	if m.syncer == nil {
+		return nil
+	}
+
+	ch := m.events
+	ctx := m.ctx
+	return func() tea.Msg {
+		go func() {
+			err := m.syncer.SubscribeEvents(ctx, func(ev sync.NoteEvent) {
+				select {
+				case ch <- remoteEventMsg{ev: ev}:
+				case <-ctx.Done():
+				}
+			})
+			select {
+			case ch <- eventsClosedMsg{err: err}:
+			case <-ctx.Done():
+			}
+		}()
+		return m.nextEvent()
+	}
+}
+
+func (m Model) waitEventCmd() tea.Cmd {
+	return m.nextEvent
+}
+
+func (m Model) nextEvent() tea.Msg {
+	select {
+	case msg := <-m.events:
+		return msg
+	case <-m.ctx.Done():
+		return nil
+	}
+}
+
+func (m Model) handleRemoteEvent(ev sync.NoteEvent) (Model, tea.Cmd) {
+	switch ev.Type {
+	case sync.EventReady:
+		if m.eventsDown {
+			m.status = "live updates reconnected"
+		}
+		m.eventsDown = false
+		m.eventsDelay = eventsRetryMin
+		return m, m.waitEventCmd()
+
+	case sync.EventNote:
+		// Our own pushes, and changes already pulled, come back as echoes.
+		if ev.Revision <= m.syncer.State.Revision(ev.Date) {
+			return m, m.waitEventCmd()
+		}
+		if m.mode == modeCompose && m.composeKind == composeEdit &&
+			m.composeDay.Format("2006-01-02") == ev.Date {
+			m.status = ev.Date + " changed on server while editing"
+			return m, m.waitEventCmd()
+		}
+		return m, tea.Batch(m.waitEventCmd(), m.pullRemoteCmd(ev))
+	}
+
+	return m, m.waitEventCmd()
+}
+
+// pullRemoteCmd applies a remote change to the local day file, unless the
+// day has local changes that were not pushed yet.
+func (m Model) pullRemoteCmd(ev sync.NoteEvent) tea.Cmd {
+	return func() tea.Msg {
+		day, err := time.ParseInLocation("2006-01-02", ev.Date, time.Local)
+		if err != nil {
+			return remotePulledMsg{err: err}
+		}
+		msg := remotePulledMsg{day: day, deleted: ev.Deleted}
+
+		// A push of this day is in flight or queued; it reports its own
+		// outcome, including conflicts.
+		if ev.Revision <= m.syncer.State.Revision(ev.Date) || m.syncer.Outbox.Has(ev.Date) {
+			msg.skipped = true
+			return msg
+		}
+
+		local, err := m.store.ReadDay(day)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		var synced, current string
+		if ns, ok := m.syncer.State.Note(ev.Date); ok && !ns.Deleted {
+			synced = ns.Hash
+		}
+		if local != "" {
+			current = sync.ContentHash(local)
+		}
+		if current != synced {
+			msg.conflict = true
+			return msg
+		}
+
+		if ev.Deleted {
+			if msg.err = m.store.RemoveDay(day); msg.err != nil {
+				return msg
+			}
+			msg.err = m.syncer.RecordSynced(sync.RemoteNote{
+				Date:      ev.Date,
+				Revision:  ev.Revision,
+				UpdatedAt: ev.UpdatedAt,
+				Deleted:   true,
+			})
+			return msg
+		}
+
+		content, err := m.syncer.PullNoteContext(m.ctx, day)
+		if err != nil || content == "" {
+			msg.err = err
+			return msg
+		}
+		msg.err = m.store.WriteDay(day, content)
+		return msg
+	}
+}
+
+// scheduleEventsReconnect resubscribes after a backoff that doubles on every
+// consecutive failure.
+func (m *Model) scheduleEventsReconnect() tea.Cmd {
+	delay := m.eventsDelay
+	m.eventsDelay = min(m.eventsDelay*2, eventsRetryMax)
+
+	return tea.Tick(delay, func(time.Time) tea.Msg {
+		return eventsReconnectMsg{}
+	})
+}
+
+// focusedDate returns the date of the focused day, or "" if none is.
+func (m Model) focusedDate() string {
+	if m.focusedDay < 0 || m.focusedDay >= len(m.days) {
+		return ""
+	}
+	return m.days[m.focusedDay].Date.Format("2006-01-02")
+}
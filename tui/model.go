@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"context"
 	"time"
 
 	"github.com/charmbracelet/bubbles/viewport"
@@ -29,6 +30,9 @@ const (
 	composePanelMinRows  = 1
 	composePanelMaxRows  = 12
 	composePanelEditRows = 8
+
+	outboxRetryMin = 15 * time.Second
+	outboxRetryMax = 5 * time.Minute
 )
 
 type streamLoadedMsg struct {
@@ -39,6 +43,15 @@ type streamLoadedMsg struct {
 }
 
 type syncResultMsg struct {
+	day    time.Time
+	err    error
+	queued bool
+}
+
+type outboxRetryMsg struct{}
+
+type outboxDrainedMsg struct {
+	res sync.DrainResult
 	err error
 }
 
@@ -49,6 +62,10 @@ type Model struct {
 	syncer   *sync.Client
 	composer *Composer
 
+	// ctx is cancelled on quit to abort in-flight sync requests.
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	mode        mode
 	composeKind composeKind
 	composeDay  time.Time
@@ -69,25 +86,50 @@ type Model struct {
 	hasMoreDays bool
 	loadingMore bool
 
+	pending        int
+	draining       bool
+	retryScheduled bool
+	retryDelay     time.Duration
+
+	// events carries messages from the server's change feed.
+	events      chan tea.Msg
+	eventsDown  bool
+	eventsDelay time.Duration
+
 	snapshot ComposerSnapshot
 	status   string
 	err      error
 }
 
 func NewApp(store *notes.Store, syncer *sync.Client, editor string) Model {
-	return Model{
-		store:      store,
-		syncer:     syncer,
-		composer:   NewComposer(editor),
-		mode:       modeStream,
-		status:     "ready",
-		focusedDay: -1,
-		loadLimit:  initialLoadDays,
+	ctx, cancel := context.WithCancel(context.Background())
+	m := Model{
+		ctx:         ctx,
+		cancel:      cancel,
+		store:       store,
+		syncer:      syncer,
+		composer:    NewComposer(editor),
+		mode:        modeStream,
+		status:      "ready",
+		focusedDay:  -1,
+		loadLimit:   initialLoadDays,
+		retryDelay:  outboxRetryMin,
+		events:      make(chan tea.Msg),
+		eventsDelay: eventsRetryMin,
+	}
+	if syncer != nil {
+		m.pending = syncer.Outbox.Len()
+		// Init starts a drain straight away when work is queued.
+		m.draining = m.pending > 0
 	}
+	return m
 }
 
 func (m Model) Init() tea.Cmd {
-	return m.loadStreamCmd("")
+	if m.draining {
+		return tea.Batch(m.loadStreamCmd(""), m.drainOutboxCmd(), m.listenEventsCmd())
+	}
+	return tea.Batch(m.loadStreamCmd(""), m.listenEventsCmd())
 }
 
 func (m Model) loadStreamCmd(anchorDate string) tea.Cmd {
@@ -105,12 +147,54 @@ func (m Model) pushDayCmd(day time.Time) tea.Cmd {
 	}
 
 	return func() tea.Msg {
+		key := day.Format("2006-01-02")
+
+		// Queue before pushing so an interrupted push (quitting mid-flight,
+		// a crash) is retried on the next start.
+		if err := m.syncer.Outbox.Add(key); err != nil {
+			return syncResultMsg{day: day, err: err}
+		}
+
 		content, err := m.store.ReadDay(day)
 		if err != nil {
-			return syncResultMsg{err: err}
+			return syncResultMsg{day: day, err: err}
+		}
+
+		err = m.syncer.PushNoteContext(m.ctx, day, content)
+		switch {
+		case err == nil, sync.IsCanceled(err):
+		case sync.IsConflict(err):
+			// Retrying cannot resolve a conflict.
+			if qerr := m.syncer.Outbox.Remove(key); qerr != nil {
+				return syncResultMsg{day: day, err: qerr}
+			}
+		default:
+			if qerr := m.syncer.Outbox.MarkFailed(key, err); qerr != nil {
+				return syncResultMsg{day: day, err: qerr}
+			}
+			return syncResultMsg{day: day, err: err, queued: m.syncer.Outbox != nil}
 		}
+		return syncResultMsg{day: day, err: err}
+	}
+}
 
-		err = m.syncer.PushNote(day, content)
-		return syncResultMsg{err: err}
+// drainOutboxCmd retries every queued push. Callers set m.draining first so
+// only one drain runs at a time.
+func (m Model) drainOutboxCmd() tea.Cmd {
+	return func() tea.Msg {
+		res, err := m.syncer.DrainOutboxContext(m.ctx, m.store.ReadDay)
+		return outboxDrainedMsg{res: res, err: err}
 	}
 }
+
+// scheduleOutboxRetry arms a single retry timer for the outbox.
+func (m *Model) scheduleOutboxRetry() tea.Cmd {
+	if m.retryScheduled || m.draining {
+		return nil
+	}
+	m.retryScheduled = true
+
+	return tea.Tick(m.retryDelay, func(time.Time) tea.Msg {
+		return outboxRetryMsg{}
+	})
+}
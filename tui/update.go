@@ -1,10 +1,12 @@
 package tui
 
 import (
+	"fmt"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/juliuswalton/scrbl/notes"
+	"github.com/juliuswalton/scrbl/sync"
 )
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -41,13 +43,91 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case syncResultMsg:
-		if msg.err != nil {
+		m.pending = m.syncer.Outbox.Len()
+		switch {
+		case sync.IsConflict(msg.err):
+			m.status = "sync conflict " + msg.day.Format("2006-01-02") + " (pull to reconcile)"
+		case msg.queued:
+			m.status = "offline, queued " + msg.day.Format("2006-01-02")
+			return m, m.scheduleOutboxRetry()
+		case msg.err != nil:
 			m.status = "sync failed"
-		} else {
+		default:
 			m.status = "synced"
+			// The server is reachable again; flush anything left behind.
+			if m.pending > 0 && !m.draining {
+				m.draining = true
+				return m, m.drainOutboxCmd()
+			}
+		}
+		return m, nil
+
+	case outboxRetryMsg:
+		m.retryScheduled = false
+		if m.draining || m.syncer.Outbox.Len() == 0 {
+			return m, nil
+		}
+		m.draining = true
+		return m, m.drainOutboxCmd()
+
+	case outboxDrainedMsg:
+		m.draining = false
+		if sync.IsCanceled(msg.err) {
+			return m, nil
+		}
+		m.pending = msg.res.Remaining
+		if len(msg.res.Conflicts) > 0 {
+			m.status = "sync conflict " + strings.Join(msg.res.Conflicts, ", ") + " (pull to reconcile)"
+		} else if msg.res.Pushed > 0 {
+			m.status = fmt.Sprintf("synced %d queued days", msg.res.Pushed)
+		}
+		if msg.err != nil {
+			m.retryDelay = min(m.retryDelay*2, outboxRetryMax)
+		} else {
+			m.retryDelay = outboxRetryMin
+		}
+		if m.pending > 0 {
+			return m, m.scheduleOutboxRetry()
 		}
 		return m, nil
 
+	case remoteEventMsg:
+		return m.handleRemoteEvent(msg.ev)
+
+	case eventsClosedMsg:
+		if sync.IsCanceled(msg.err) {
+			return m, nil
+		}
+		if !m.eventsDown {
+			m.status = "live updates offline"
+		}
+		m.eventsDown = true
+		return m, m.scheduleEventsReconnect()
+
+	case eventsReconnectMsg:
+		return m, m.listenEventsCmd()
+
+	case remotePulledMsg:
+		key := msg.day.Format("2006-01-02")
+		switch {
+		case msg.skipped:
+			return m, nil
+		case msg.err != nil:
+			if sync.IsCanceled(msg.err) {
+				return m, nil
+			}
+			m.status = "pull failed " + key
+			return m, nil
+		case msg.conflict:
+			m.status = "sync conflict " + key + " (pull to reconcile)"
+			return m, nil
+		case msg.deleted:
+			m.status = key + " deleted on server"
+		default:
+			m.status = "updated " + key + " from server"
+		}
+		return m, m.loadStreamCmd(m.focusedDate())
+
 	case composerPollMsg:
 		if m.mode != modeCompose {
 			return m, nil
@@ -93,8 +173,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m Model) handleStreamKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "ctrl+c", "q":
-		m.composer.Close()
-		return m, tea.Quit
+		return m.quit()
 	case "i":
 		return m.startComposeNew()
 	case "e", "enter":
@@ -146,11 +225,18 @@ func (m Model) handleStreamKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// quit aborts in-flight sync requests and exits. Interrupted pushes stay in
+// the outbox and are retried on the next start.
+func (m Model) quit() (tea.Model, tea.Cmd) {
+	m.cancel()
+	m.composer.Close()
+	return m, tea.Quit
+}
+
 func (m Model) handleComposeKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "ctrl+c":
-		m.composer.Close()
-		return m, tea.Quit
+		return m.quit()
 	case "ctrl+g":
 		m.mode = modeStream
 		m.status = "stream"
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
@@ -77,7 +78,12 @@ func (m Model) statusBar() string {
 		help = "[:w] save [:q] back [:wq/:x] save+back [Ctrl+C] quit"
 	}
 
-	left := modeBadge.Render(" "+modeText+" ") + subtleStyle.Render(" "+m.status+focused)
+	pending := ""
+	if m.pending > 0 {
+		pending = fmt.Sprintf(" · %d pending", m.pending)
+	}
+
+	left := modeBadge.Render(" "+modeText+" ") + subtleStyle.Render(" "+m.status+focused+pending)
 	right := subtleStyle.Render(help)
 	gap := m.width - lipgloss.Width(left) - lipgloss.Width(right)
 	if gap < 1 {